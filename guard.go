@@ -0,0 +1,410 @@
+package erouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// A guarded handler of the route, it is used when the request satisfies all the constraints.
+	//
+	// 路由的约束处理者，请求满足全部约束时使用。
+	routeGuard struct {
+		constraints []routeConstraint
+		isany       bool
+		// 注册的标签，第一个为route
+		tags []string
+		vals []string
+		// 组合中间件后的处理者，注册的原始处理者和使用的中间件数量
+		handlers Handler
+		handler  Handler
+		mnum     int
+		source   string
+	}
+	// A constraint on the request header, query or cookie, such as header:X-Api-Version=2,
+	// or the media type produced by the route, such as produces=application/json.
+	//
+	// 请求header、query或cookie的约束，例如header:X-Api-Version=2，或者路由产生的媒体类型，例如produces=application/json。
+	routeConstraint struct {
+		kind  string
+		name  string
+		value string
+	}
+)
+
+// Get the constraints from the route args, the tags prefixed with header:, query: and cookie: and the produces tags are constraints.
+//
+// 从路由参数获取约束，header:、query:和cookie:前缀的标签和produces标签为约束。
+func getRouteConstraints(args []string) []routeConstraint {
+	var constraints []routeConstraint
+	for _, str := range args[1:] {
+		key, val := split2byte(str, '=')
+		if key == ParamProduces {
+			constraints = append(constraints, routeConstraint{kind: ParamProduces, value: val})
+			continue
+		}
+		kind, name := split2byte(key, ':')
+		switch kind {
+		case "header", "query", "cookie":
+			constraints = append(constraints, routeConstraint{kind: kind, name: name, value: val})
+		}
+	}
+	return constraints
+}
+
+// Whether the request satisfies the constraint, the produces constraint is negotiated by newHandlerGuards.
+//
+// 请求是否满足约束，produces约束由newHandlerGuards协商。
+func (c routeConstraint) match(req *http.Request) bool {
+	switch c.kind {
+	case ParamProduces:
+		return true
+	case "header":
+		return req.Header.Get(c.name) == c.value
+	case "query":
+		return req.URL.Query().Get(c.name) == c.value
+	case "cookie":
+		cookie, err := req.Cookie(c.name)
+		return err == nil && cookie.Value == c.value
+	}
+	return false
+}
+
+// Create a guarded handler, the tags are set as the node, the handlers are combined later with the middlewares.
+//
+// 创建一个约束处理者，标签和节点相同设置，处理者之后和中间件组合。
+func newRouteGuard(args []string, constraints []routeConstraint, isany bool, handler Handler, source string) *routeGuard {
+	guard := &routeGuard{
+		constraints: constraints,
+		isany:       isany,
+		tags:        make([]string, len(args)),
+		vals:        make([]string, len(args)),
+		handler:     handler,
+		source:      source,
+	}
+	guard.tags[0], guard.vals[0] = ParamRoute, args[0]
+	for i, str := range args[1:] {
+		guard.tags[i+1], guard.vals[i+1] = split2byte(str, '=')
+	}
+	return guard
+}
+
+// Whether the constraints of the guard are the same as constraints, the order is ignored.
+//
+// 约束处理者的约束是否和constraints相同，忽略顺序。
+func (guard *routeGuard) equal(constraints []routeConstraint) bool {
+	if len(guard.constraints) != len(constraints) {
+		return false
+	}
+	for _, c := range constraints {
+		var found bool
+		for _, gc := range guard.constraints {
+			found = found || gc == c
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the guard with the same constraints, return nil if not found.
+//
+// 获取约束相同的约束处理者，未找到返回nil。
+func getRouteGuard(guards []*routeGuard, constraints []routeConstraint) *routeGuard {
+	for _, guard := range guards {
+		if guard.equal(constraints) {
+			return guard
+		}
+	}
+	return nil
+}
+
+// Insert the guard into a new slice, the guard with the same constraints is replaced, otherwise appended in registration order.
+//
+// The guards are shared with the copied routing data, so a new slice is created.
+//
+// 将约束处理者插入新的切片，约束相同的约束处理者被替换，否则按照注册顺序追加。
+//
+// 约束处理者和复制的路由数据共享，所以创建新的切片。
+func insertRouteGuard(guards []*routeGuard, guard *routeGuard) []*routeGuard {
+	newGuards := make([]*routeGuard, 0, len(guards)+1)
+	replaced := false
+	for _, g := range guards {
+		if !replaced && g.equal(guard.constraints) {
+			g, replaced = guard, true
+		}
+		newGuards = append(newGuards, g)
+	}
+	if !replaced {
+		newGuards = append(newGuards, guard)
+	}
+	return newGuards
+}
+
+// Remove the guard with the same constraints into a new slice.
+//
+// 删除约束相同的约束处理者到新的切片。
+func removeRouteGuard(guards []*routeGuard, constraints []routeConstraint) []*routeGuard {
+	var newGuards []*routeGuard
+	for _, g := range guards {
+		if !g.equal(constraints) {
+			newGuards = append(newGuards, g)
+		}
+	}
+	return newGuards
+}
+
+// Combine the handlers of the guards with the middlewares matched by the route again, new guards are created.
+//
+// 使用路由匹配的中间件重新组合约束处理者的处理者，创建新的约束处理者。
+func combineRouteGuards(guards []*routeGuard, method string, middtree *middTree) []*routeGuard {
+	newGuards := make([]*routeGuard, len(guards))
+	for i, g := range guards {
+		hs := middtree.lookup(method, g.vals[0], getTagValue(g.tags, g.vals, ParamSkip))
+		newGuard := *g
+		newGuard.handlers = CombineHandler(g.handler, hs)
+		newGuard.mnum = len(hs)
+		newGuards[i] = &newGuard
+	}
+	return newGuards
+}
+
+// Append the route information of the guards.
+//
+// 追加约束处理者的路由信息。
+func appendGuardRoutes(routes []RouteInfo, guards []*routeGuard, method string, params, checks []string) []RouteInfo {
+	for _, g := range guards {
+		routes = append(routes, newRouteInfo(method, g.tags, g.vals, params, checks, g.isany, g.mnum))
+	}
+	return routes
+}
+
+// Get the media types produced by the guards, separated by ", ", the node adds them to the params when matched.
+//
+// 获取约束处理者产生的媒体类型，使用", "分隔，节点匹配时添加到参数。
+func getGuardProduces(guards []*routeGuard) string {
+	var produces []string
+	for _, guard := range guards {
+		for _, c := range guard.constraints {
+			if c.kind == ParamProduces && !stringSliceContains(produces, c.value) {
+				produces = append(produces, c.value)
+			}
+		}
+	}
+	return strings.Join(produces, ", ")
+}
+
+// Whether the media types separated by ", " contain the media type.
+//
+// 使用", "分隔的媒体类型是否包含媒体类型。
+func hasProduces(produces, mime string) bool {
+	for len(produces) > 0 {
+		var item string
+		item, produces = produces, ""
+		if pos := strings.Index(item, ", "); pos != -1 {
+			item, produces = item[:pos], item[pos+2:]
+		}
+		if strings.EqualFold(item, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the guard satisfies all the constraints except produces, and whether the guard has the produces constraint.
+//
+// 约束处理者是否满足produces外的全部约束，和是否带有produces约束。
+func (guard *routeGuard) match(req *http.Request) (bool, bool) {
+	var produces bool
+	for _, c := range guard.constraints {
+		if !c.match(req) {
+			return false, false
+		}
+		produces = produces || c.kind == ParamProduces
+	}
+	return true, produces
+}
+
+// Create a handler that chooses the first guard whose constraints are all satisfied in registration order,
+// then chooses the guard with produces constraints by the Accept header, the media type of the path extension removed by the router overrides the header.
+// If no guard matches, use the fallback handler registered without constraints, and use notfound if there is no fallback,
+// use notacceptable if the guards with produces constraints match but no media type is acceptable.
+//
+// The tags of the chosen guard are set to the params, and the chosen media type is set to the produces param.
+//
+// 创建一个按照注册顺序选择第一个约束全部满足的约束处理者的处理者，然后按照Accept Header选择带有produces约束的约束处理者，路由器去除的路径扩展名对应的媒体类型覆盖Header。
+// 如果没有约束处理者匹配，使用没有约束注册的处理者，如果没有使用notfound；如果带有produces约束的约束处理者匹配但是没有可接受的媒体类型，使用notacceptable。
+//
+// 选择的约束处理者的标签设置到参数，选择的媒体类型设置到produces参数。
+func newHandlerGuards(guards []*routeGuard, fallback, notfound, notacceptable Handler) Handler {
+	if len(guards) == 0 {
+		return fallback
+	}
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		var negotiate bool
+		for _, guard := range guards {
+			matched, produces := guard.match(req)
+			if matched && !produces {
+				guard.setParams(p)
+				guard.handlers(w, req, p)
+				return
+			}
+			negotiate = negotiate || matched
+		}
+		if negotiate {
+			accept := req.Header.Get("Accept")
+			if mime, ok := RouterProducesExtension[getPathExtension(req.URL.Path)]; ok && mime == p.GetParam(ParamProduces) {
+				accept = mime
+			}
+			if guard, mime := getAcceptGuard(guards, req, accept); guard != nil {
+				guard.setParams(p)
+				p.SetParam(ParamProduces, mime)
+				guard.handlers(w, req, p)
+				return
+			}
+		}
+		switch {
+		case fallback != nil:
+			if len(p.GetParam(ParamProduces)) != 0 {
+				p.SetParam(ParamProduces, "")
+			}
+			fallback(w, req, p)
+		case negotiate:
+			notacceptable(w, req, p)
+		default:
+			notfound(w, req, p)
+		}
+	}
+}
+
+// Set the tags of the guard to the params, the node only gives the route and redirect tags, so the tags of the fallback are not added.
+//
+// 将约束处理者的标签设置到参数，节点只给予route和redirect标签，所以不会添加默认处理者的标签。
+func (guard *routeGuard) setParams(p Params) {
+	for i := range guard.tags {
+		p.SetParam(guard.tags[i], guard.vals[i])
+	}
+}
+
+// Create a handler that sets the tags to the params, it is the fallback handler of the node with guards.
+//
+// 创建一个将标签设置到参数的处理者，为带有约束处理者的节点的默认处理者。
+func newHandlerTags(handler Handler, tags, vals []string) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		for i := range tags {
+			p.SetParam(tags[i], vals[i])
+		}
+		handler(w, req, p)
+	}
+}
+
+// Get the guard with produces constraints and the media type that the Accept header prefers.
+//
+// The media type with the highest quality is chosen, then the more specific media range, then the earlier media range in the header,
+// and then the guard registered earlier, an empty Accept header accepts all media types.
+//
+// 获取Accept Header优先的带有produces约束的约束处理者和媒体类型。
+//
+// 依次选择质量最高、媒体范围更具体、媒体范围在Header中更靠前、更早注册的媒体类型，Accept Header为空时接受全部媒体类型。
+func getAcceptGuard(guards []*routeGuard, req *http.Request, accept string) (*routeGuard, string) {
+	if len(accept) == 0 {
+		accept = "*/*"
+	}
+	var best *routeGuard
+	var mime string
+	var bestq float64
+	var bestspec, bestindex int
+	for _, guard := range guards {
+		if matched, produces := guard.match(req); !matched || !produces {
+			continue
+		}
+		for _, c := range guard.constraints {
+			if c.kind != ParamProduces {
+				continue
+			}
+			q, spec, index := getAcceptQuality(accept, c.value)
+			if q > bestq || (q == bestq && best != nil && (spec > bestspec || (spec == bestspec && index < bestindex))) {
+				best, mime, bestq, bestspec, bestindex = guard, c.value, q, spec, index
+			}
+		}
+	}
+	return best, mime
+}
+
+// Get the quality of the media type in the Accept header, the specificity and the index of the most specific media range that matches.
+//
+// The media range is '*/*', 'type/*' or 'type/subtype', the parameters other than q are ignored, the quality is 0 if not acceptable.
+//
+// 获取媒体类型在Accept Header中的质量，以及匹配的最具体媒体范围的精度和位置。
+//
+// 媒体范围为'*/*'、'type/*'或'type/subtype'，忽略q以外的参数，不可接受时质量为0。
+func getAcceptQuality(accept, mime string) (float64, int, int) {
+	mtype, _ := split2byte(mime+"/", '/')
+	q, spec, index := 0.0, -1, -1
+	for i := 0; len(accept) > 0; i++ {
+		var item string
+		item, accept = accept, ""
+		if pos := strings.IndexByte(item, ','); pos != -1 {
+			item, accept = item[:pos], item[pos+1:]
+		}
+		var params string
+		if pos := strings.IndexByte(item, ';'); pos != -1 {
+			item, params = item[:pos], item[pos+1:]
+		}
+		item = strings.TrimSpace(item)
+		var s int
+		switch {
+		case item == "*/*":
+			s = 0
+		case strings.HasSuffix(item, "/*") && strings.EqualFold(item[:len(item)-2], mtype):
+			s = 1
+		case strings.EqualFold(item, mime):
+			s = 2
+		default:
+			continue
+		}
+		if s <= spec {
+			continue
+		}
+		itemq, ok := getAcceptParamQ(params)
+		if !ok {
+			continue
+		}
+		q, spec, index = itemq, s, i
+	}
+	return q, spec, index
+}
+
+// Get the q parameter of the media range, the default is 1, an invalid value returns false.
+//
+// 获取媒体范围的q参数，默认为1，无效的值返回false。
+func getAcceptParamQ(params string) (float64, bool) {
+	for len(params) > 0 {
+		var param string
+		param, params = params, ""
+		if pos := strings.IndexByte(param, ';'); pos != -1 {
+			param, params = param[:pos], param[pos+1:]
+		}
+		key, val := split2byte(param, '=')
+		if strings.TrimSpace(key) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return q, err == nil && q >= 0 && q <= 1
+	}
+	return 1, true
+}
+
+// Get the extension of the last segment of the path, including '.', return empty if there is no extension.
+//
+// 获取路径最后一段的扩展名，包含'.'，没有扩展名返回空。
+func getPathExtension(path string) string {
+	for i := len(path) - 1; i > 0 && path[i] != '/'; i-- {
+		if path[i] == '.' {
+			return path[i:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package erouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterProducesExtension(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/report produces=application/json", newTestHandler(ParamProduces))
+		r.Get("/report.json", newTestHandler(ParamProduces))
+		r.Get("/files/*path produces=application/json", newTestHandler("path"))
+		r.Get("/u/:name produces=text/html", newTestHandler("name"))
+		r.Get("/d produces=application/json", newTestHandler(ParamProduces))
+		r.Get("/h header:X-A=1", newTestHandler())
+		r.Get("/h", func(w http.ResponseWriter, req *http.Request, p Params) {
+			if len(p.(*ParamsArray).Keys) != 1 {
+				w.WriteHeader(500)
+			}
+			newTestHandler()(w, req, p)
+		})
+		for _, c := range []struct {
+			path string
+			code int
+			body string
+		}{
+			{"/report.json", 200, "/report.json produces="},
+			{"/report", 200, "/report produces=application/json"},
+			{"/files/data.json", 200, "/files/*path path=data.json"},
+			{"/u/index.html", 200, "/u/:name name=index.html"},
+			{"/d.json", 200, "/d produces=application/json"},
+			{"/d.xml", 406, "406 not acceptable\n"},
+			{"/h", 200, "/h"},
+		} {
+			if code, body := doTestRequest(r, "GET", c.path); code != c.code || body != c.body {
+				t.Errorf("%T %s: %d %q, want %d %q", r, c.path, code, body, c.code, c.body)
+			}
+		}
+	}
+}
+
+func TestRouterGuards(t *testing.T) {
+	keys := func(w http.ResponseWriter, req *http.Request, p Params) {
+		pa := p.(*ParamsArray)
+		for i := range pa.Keys {
+			w.Write([]byte(pa.Keys[i] + "=" + pa.Vals[i] + " "))
+		}
+	}
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/g version=v1 owner=fallback", keys)
+		r.Get("/g header:X-V=2", keys)
+		r.Get("/g header:X-V=3 owner=three", keys)
+		r.Get("/o header:X-A=1", keys)
+		r.Get("/o query:b=2", keys)
+		r.Get("/n header:X-A=1", keys)
+		for _, c := range []struct {
+			path   string
+			header string
+			code   int
+			body   string
+		}{
+			{"/g", "", 200, "route=/g version=v1 owner=fallback "},
+			{"/g", "2", 200, "route=/g header:X-V=2 "},
+			{"/g", "3", 200, "route=/g header:X-V=3 owner=three "},
+			{"/o?b=2", "", 200, "route=/o query:b=2 "},
+			{"/o?b=2", "1", 200, "route=/o header:X-A=1 "},
+			{"/n", "", 404, "404 page not found\n"},
+		} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", c.path, nil)
+			req.Header.Set("X-V", c.header)
+			req.Header.Set("X-A", c.header)
+			r.ServeHTTP(w, req)
+			if w.Code != c.code || w.Body.String() != c.body {
+				t.Errorf("%T %s %q: %d %q, want %d %q", r, c.path, c.header, w.Code, w.Body.String(), c.code, c.body)
+			}
+		}
+	}
+}
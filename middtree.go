@@ -1,108 +1,275 @@
 package erouter
 
 import (
+	"sort"
 	"strings"
 )
 
 type (
-	// 存储中间件信息的基数树。
+	// 存储中间件信息的作用域列表。
 	//
-	// 用于内存存储路由器中间件注册信息，并根据注册路由返回对应的中间件。
+	// 中间件作用域和路由使用相同的常量、参数、通配符语法，按照路径段匹配路由，并根据注册路由返回对应的中间件。
 	middTree struct {
-		root middNode
+		// ANY方法根路径的中间件和名称，404和405处理同样使用
+		val    []Middleware
+		names  []string
+		scopes []*middScope
 	}
-	middNode struct {
-		path     string
-		children []*middNode
-		key      string
+	// 一个方法和路径的中间件作用域。
+	middScope struct {
+		method   string
+		segments []string
 		val      []Middleware
+		names    []string
 	}
 )
 
-func (r *middNode) Insert(key string, val []Middleware) {
-	r.recursiveInsertTree(key, key, val)
+// Insert the middlewares of the method and path, the middlewares of the same scope are appended in order, name is the name of the middlewares.
+//
+// 插入方法和路径的中间件，相同作用域的中间件按顺序追加，name为中间件的名称。
+func (t *middTree) Insert(method, path, name string, val []Middleware) {
+	names := make([]string, len(val))
+	for i := range names {
+		names[i] = name
+	}
+	segments := getScopeSegments(path)
+	if method == MethodAny && len(segments) == 0 {
+		t.val = combineMiddlewares(t.val, val)
+		t.names = append(t.names[:len(t.names):len(t.names)], names...)
+		return
+	}
+	for _, scope := range t.scopes {
+		if scope.method == method && scope.equal(segments) {
+			scope.val = combineMiddlewares(scope.val, val)
+			scope.names = append(scope.names[:len(scope.names):len(scope.names)], names...)
+			return
+		}
+	}
+	t.scopes = append(t.scopes, &middScope{
+		method:   method,
+		segments: segments,
+		val:      val,
+		names:    names,
+	})
 }
 
-//Lookup: Find if seachKey exist in current radix tree and return its value
-func (r *middNode) Lookup(searchKey string) []Middleware {
-	searchKey = strings.Split(searchKey, " ")[0]
-	if searchKey[len(searchKey)-1] == '*' {
-		searchKey = searchKey[:len(searchKey)-1]
+// Remove the middlewares named name from the scope of the method and path, if name is empty, remove all middlewares of the scope.
+//
+// The middlewares are shared with the copied middleware tree, so new slices are created.
+//
+// 从方法和路径的作用域删除名称为name的中间件，如果name为空删除作用域的全部中间件。
+//
+// 中间件和复制的中间件树共享，所以创建新的切片。
+func (t *middTree) Remove(method, path, name string) {
+	segments := getScopeSegments(path)
+	if method == MethodAny && len(segments) == 0 {
+		t.val, t.names = removeMiddlewares(t.val, t.names, name)
+		return
+	}
+	for i, scope := range t.scopes {
+		if scope.method == method && scope.equal(segments) {
+			scope.val, scope.names = removeMiddlewares(scope.val, scope.names, name)
+			if len(scope.val) == 0 {
+				t.scopes = append(t.scopes[:i:i], t.scopes[i+1:]...)
+			}
+			return
+		}
 	}
-	return r.recursiveLoopup(searchKey)
 }
 
-// 新增Node
-func (r *middNode) InsertNode(path, key string, value []Middleware) {
-	if len(path) == 0 {
-		// 路径空就设置当前node的值
-		r.key = key
-		r.val = combineMiddlewares(r.val, value)
-	} else {
-		// 否则新增node
-		r.children = append(r.children, &middNode{path: path, key: key, val: value})
-	}
+// Lookup the middlewares of the route, key is the route path and tags, the middlewares named in the skip tag are excluded.
+//
+// 查找路由的中间件，key为路由路径和标签，排除skip标签中名称的中间件。
+func (t *middTree) Lookup(method, key string) []Middleware {
+	args := splitRouteArgs(key)
+	return t.lookup(method, args[0], getRouteTag(args, ParamSkip))
 }
 
-// 对指定路径为edgeKey的Node分叉，公共前缀路径为pathKey
-func (r *middNode) SplitNode(pathKey, edgeKey string) *middNode {
-	for i := range r.children {
-		if r.children[i].path == edgeKey {
-			newNode := &middNode{path: pathKey}
-			newNode.children = append(newNode.children, &middNode{
-				path:     strings.TrimPrefix(edgeKey, pathKey),
-				key:      r.children[i].key,
-				val:      r.children[i].val,
-				children: r.children[i].children,
-			})
-			r.children[i] = newNode
-			return newNode
+// Lookup the middlewares of the route path, the matched scopes are sorted from least to most specific.
+//
+// The scope of the ANY method matches all methods; scopes with the same specificity are sorted in registration order.
+//
+// skip is the comma-separated names of the middlewares to be excluded.
+//
+// 查找路由路径的中间件，匹配的作用域按照从最不具体到最具体的顺序排列。
+//
+// ANY方法的作用域匹配全部方法；具体程度相同的作用域按照注册顺序排列。
+//
+// skip为逗号分隔的需要排除的中间件名称。
+func (t *middTree) lookup(method, path, skip string) []Middleware {
+	segments := getPathSegments(path)
+	var scopes []*middScope
+	for _, scope := range t.scopes {
+		if (scope.method == method || scope.method == MethodAny) && scope.match(segments) {
+			scopes = append(scopes, scope)
 		}
 	}
-	return nil
+	if len(scopes) == 0 && len(skip) == 0 {
+		return t.val
+	}
+	sort.SliceStable(scopes, func(i, j int) bool {
+		return scopes[i].less(scopes[j])
+	})
+	var skips []string
+	if len(skip) != 0 {
+		skips = strings.Split(skip, ",")
+	}
+	hs := appendMiddlewares(nil, t.val, t.names, skips)
+	for _, scope := range scopes {
+		hs = appendMiddlewares(hs, scope.val, scope.names, skips)
+	}
+	return hs
+}
+
+// Copy the scope list, middlewares are shared.
+//
+// 复制作用域列表，中间件共享。
+func (t *middTree) clone() *middTree {
+	newTree := &middTree{
+		val:    t.val,
+		names:  t.names,
+		scopes: make([]*middScope, len(t.scopes)),
+	}
+	for i, scope := range t.scopes {
+		newScope := *scope
+		newTree.scopes[i] = &newScope
+	}
+	return newTree
 }
 
-// 给currentNode递归添加，路径为containKey的Node。
-func (r *middNode) recursiveInsertTree(containKey string, targetKey string, targetValue []Middleware) {
-	for i := range r.children {
-		subStr, find := getSubsetPrefix(containKey, r.children[i].path)
-		if find {
-			if subStr == r.children[i].path {
-				nextTargetKey := strings.TrimPrefix(containKey, r.children[i].path)
-				r.children[i].recursiveInsertTree(nextTargetKey, targetKey, targetValue)
-			} else {
-				newNode := r.SplitNode(subStr, r.children[i].path)
-				if newNode == nil {
-					panic("Unexpect error on split node")
-				}
-
-				newNode.InsertNode(strings.TrimPrefix(containKey, subStr), targetKey, targetValue)
+// Whether the scope matches the route segments, the scope segments must be the prefix of the route segments.
+//
+// A constant segment matches the same constant, a param segment matches any non-empty non-wildcard segment, and a wildcard segment matches the rest.
+//
+// 作用域是否匹配路由路径段，作用域路径段需要是路由路径段的前缀。
+//
+// 常量段匹配相同的常量，参数段匹配非空并且不是通配符的任意段，通配符段匹配剩余全部路径。
+func (scope *middScope) match(segments []string) bool {
+	for i, seg := range scope.segments {
+		if i >= len(segments) {
+			return false
+		}
+		switch {
+		case seg[0] == '*':
+			return true
+		case seg[0] == ':':
+			if len(segments[i]) == 0 || segments[i][0] == '*' {
+				return false
 			}
-			return
+		case seg != segments[i]:
+			return false
 		}
 	}
-	r.InsertNode(containKey, targetKey, targetValue)
+	return true
 }
 
-// 递归获得r路径为searchKey的Node数据。
-func (r *middNode) recursiveLoopup(searchKey string) []Middleware {
-	if len(searchKey) == 0 {
-		return r.val
+// Whether the scope has the same segments, the scope paths are compared in the normalized form of getScopeSegments.
+//
+// 作用域是否有相同的路径段，作用域路径使用getScopeSegments的规范形式比较。
+func (scope *middScope) equal(segments []string) bool {
+	if len(scope.segments) != len(segments) {
+		return false
+	}
+	for i := range segments {
+		if scope.segments[i] != segments[i] {
+			return false
+		}
 	}
+	return true
+}
 
-	for _, edgeObj := range r.children {
-		// 寻找相同前缀node
-		if contrainPrefix(searchKey, edgeObj.path) {
-			nextSearchKey := strings.TrimPrefix(searchKey, edgeObj.path)
-			return append(r.val, edgeObj.recursiveLoopup(nextSearchKey)...)
+// Whether the scope is less specific than other, the scope with fewer segments or fewer constant segments is less specific.
+//
+// 作用域是否比other更不具体，路径段或常量段更少的作用域更不具体。
+func (scope *middScope) less(other *middScope) bool {
+	if len(scope.segments) != len(other.segments) {
+		return len(scope.segments) < len(other.segments)
+	}
+	return scope.consts() < other.consts()
+}
+
+func (scope *middScope) consts() int {
+	var n int
+	for _, seg := range scope.segments {
+		if seg[0] != ':' && seg[0] != '*' {
+			n++
 		}
 	}
+	return n
+}
 
-	if len(r.key) == 0 || r.key[len(r.key)-1] == '/' {
-		return r.val
+// Split the path into segments by '/' using the same grammar as the route, the '/' in the regular expression does not split.
+//
+// 使用和路由相同的语法按照'/'将路径切割成路径段，正则中的'/'不会切割。
+func getPathSegments(path string) []string {
+	if len(path) == 0 || path[0] != '/' {
+		path = "/" + path
+	}
+	var segments []string
+	var seg string
+	for _, str := range getSplitPath(path) {
+		if str[0] == ':' || str[0] == '*' {
+			seg += str
+			continue
+		}
+		strs := strings.Split(str, "/")
+		seg += strs[0]
+		for _, s := range strs[1:] {
+			segments = append(segments, seg)
+			seg = s
+		}
 	}
+	// 第一个路径段为'/'之前的空字符串
+	return append(segments, seg)[1:]
+}
 
-	return nil
+// Split the path of the scope into segments, the empty segments are removed, "/api/", "/api" and "/api//" are the same scope.
+//
+// 切割作用域的路径段，删除空路径段，"/api/"、"/api"和"/api//"为相同作用域，例如Group("/api/")添加"/v1"的中间件。
+func getScopeSegments(path string) []string {
+	var segments []string
+	for _, seg := range getPathSegments(path) {
+		if len(seg) != 0 {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// Append the middlewares whose names are not in skips.
+//
+// 追加名称不在skips中的中间件。
+func appendMiddlewares(hs, val []Middleware, names, skips []string) []Middleware {
+	for i := range val {
+		if len(names[i]) == 0 || !stringSliceContains(skips, names[i]) {
+			hs = append(hs, val[i])
+		}
+	}
+	return hs
+}
+
+// Create new slices without the middlewares named name, if name is empty, return empty slices.
+//
+// 创建不包含名称为name的中间件的新切片，如果name为空返回空切片。
+func removeMiddlewares(val []Middleware, names []string, name string) ([]Middleware, []string) {
+	var newVal []Middleware
+	var newNames []string
+	for i := range val {
+		if len(name) != 0 && names[i] != name {
+			newVal = append(newVal, val[i])
+			newNames = append(newNames, names[i])
+		}
+	}
+	return newVal, newNames
+}
+
+func stringSliceContains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
 }
 
 func combineMiddlewares(hs1, hs2 []Middleware) []Middleware {
@@ -114,11 +281,7 @@ func combineMiddlewares(hs1, hs2 []Middleware) []Middleware {
 		return hs1
 	}
 	// combine
-	const abortIndex int8 = 63
 	finalSize := len(hs1) + len(hs2)
-	if finalSize >= int(abortIndex) {
-		panic("too many handlers")
-	}
 	hs := make([]Middleware, finalSize)
 	copy(hs, hs1)
 	copy(hs[len(hs1):], hs2)
@@ -0,0 +1,84 @@
+package erouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareEmptyScopeSegment(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		var called bool
+		r.Group("/api/").AddMiddleware("ANY", "/v1", func(h Handler) Handler {
+			return func(w http.ResponseWriter, req *http.Request, p Params) {
+				called = true
+				h(w, req, p)
+			}
+		})
+		r.Get("/api/v1/users", func(http.ResponseWriter, *http.Request, Params) {})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users", nil))
+		if !called {
+			t.Errorf("%T middleware of scope /api//v1 is not called", r)
+		}
+	}
+}
+
+func TestMiddlewareAfterRoute(t *testing.T) {
+	mw := func(h Handler) Handler {
+		return func(w http.ResponseWriter, req *http.Request, p Params) {
+			w.Write([]byte("mw "))
+			h(w, req, p)
+		}
+	}
+	host := NewRouterHost().(*RouterHost)
+	host.RegisterHost("api.example.com", NewRouterFull())
+	for _, c := range []struct {
+		Router
+		tags []string
+	}{
+		{NewRouterRadix(), []string{""}},
+		{NewRouterFull(), []string{""}},
+		{host, []string{"", " host=api.example.com"}},
+	} {
+		for _, tag := range c.tags {
+			c.Get("/a/:id"+tag, newTestHandler())
+		}
+		for _, tag := range c.tags {
+			c.AddMiddleware(MethodAny, "/a"+tag, mw)
+		}
+		for _, h := range []string{"example.com", "api.example.com"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/a/1", nil)
+			req.Host = h
+			c.ServeHTTP(w, req)
+			if w.Body.String() != "mw /a/:id" {
+				t.Errorf("%T %s/a/1: %q, want %q", c.Router, h, w.Body.String(), "mw /a/:id")
+			}
+		}
+	}
+}
+
+func TestMiddlewareScopeTrailingSlash(t *testing.T) {
+	mw := func(h Handler) Handler {
+		return func(w http.ResponseWriter, req *http.Request, p Params) {
+			w.Write([]byte("mw "))
+			h(w, req, p)
+		}
+	}
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/api/users", newTestHandler())
+		r.AddMiddleware(MethodAny, "/api mwname=a", mw)
+		r.AddMiddleware(MethodAny, "/api/ mwname=b", mw)
+		if _, body := doTestRequest(r, "GET", "/api/users"); body != "mw mw /api/users" {
+			t.Errorf("%T /api/users: %q", r, body)
+		}
+		r.RemoveMiddleware(MethodAny, "/api/", "a")
+		if _, body := doTestRequest(r, "GET", "/api/users"); body != "mw /api/users" {
+			t.Errorf("%T /api/users after removing a: %q", r, body)
+		}
+		r.RemoveMiddleware(MethodAny, "/api//", "")
+		if _, body := doTestRequest(r, "GET", "/api/users"); body != "/api/users" {
+			t.Errorf("%T /api/users after removing the scope: %q", r, body)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package erouter
+
+import (
+	"strings"
+)
+
+// PatternKind is the kind of the segment of the route pattern.
+//
+// PatternKind是路由模式片段的类型。
+type PatternKind uint8
+
+// The kinds of the segment of the route pattern.
+//
+// 路由模式片段的类型。
+const (
+	PatternConst         PatternKind = iota // 常量
+	PatternParam                            // 参数
+	PatternRegexParam                       // 参数正则或函数校验
+	PatternWildcard                         // 通配符
+	PatternValidWildcard                    // 通配符正则或函数校验
+)
+
+type (
+	// Pattern is the parsed route string, containing the path, the typed segments of the path and the tags.
+	//
+	// Pattern是解析后的路由字符串，包含路径、路径的类型片段和标签。
+	Pattern struct {
+		Path     string
+		Segments []PatternSegment
+		Tags     []PatternTag
+	}
+	// PatternSegment is a segment of the route path, a constant segment may contain multiple '/'.
+	//
+	// PatternSegment是路由路径的一个片段，常量片段可以包含多个'/'。
+	PatternSegment struct {
+		Kind PatternKind
+		// Node的路径，不包含可选标记，例如:id|isnum
+		Path string
+		// 参数或通配符的名称
+		Name string
+		// 校验函数或正则，多个校验函数使用'|'连接
+		Check string
+		// 是否为可选参数和可选参数的默认值
+		Optional bool
+		Default  string
+		// 片段在路径中的偏移
+		Pos int
+	}
+	// PatternTag is a tag of the route string written as key=value.
+	//
+	// PatternTag是路由字符串中写作key=value的一个标签。
+	PatternTag struct {
+		Name  string
+		Value string
+		// 标签在路由字符串中的偏移
+		Pos int
+	}
+	// The segments of a path expanded from the optional params, defaults are the tags of the default values.
+	//
+	// 由可选参数展开的一个路径的片段，defaults为默认值的标签。
+	patternPath struct {
+		segments []PatternSegment
+		defaults []string
+	}
+)
+
+// ParsePattern parses the route string into the path segments and tags, the routers use the same grammar.
+//
+// The route string is split by splitRouteArgs, the path is cut by getSplitPath,
+// and the optional params must be the whole trailing segments.
+//
+// ParsePattern将路由字符串解析为路径片段和标签，路由器使用相同的语法。
+//
+// 路由字符串使用splitRouteArgs切割，路径使用getSplitPath切割，可选参数必须是末尾的完整路径段。
+func ParsePattern(key string) (*Pattern, error) {
+	p, err := parsePattern(key)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parsePattern(key string) (*Pattern, *RouteError) {
+	path, n := scanRouteArg(key, true)
+	p := &Pattern{Path: path}
+	for pos := n; pos < len(key); pos += n {
+		if key[pos] == ' ' {
+			n = 1
+			continue
+		}
+		var arg string
+		arg, n = scanRouteArg(key[pos:], false)
+		name, value := split2byte(arg, '=')
+		p.Tags = append(p.Tags, PatternTag{Name: name, Value: value, Pos: pos})
+	}
+
+	var optional bool
+	var pos int
+	for _, str := range getSplitPath(path) {
+		seg := newPatternSegment(str, pos)
+		switch {
+		case seg.Kind == PatternConst && optional && str != "/":
+			return nil, newRouteError("", path, pos, "optional param must be followed by optional params only")
+		case seg.Kind == PatternConst:
+		case strings.ContainsAny(seg.Name, "?=") || (seg.Optional && len(seg.Name) == 0):
+			return nil, newRouteError("", path, pos, "invalid optional param '"+str+"'")
+		case seg.Optional && (len(p.Segments) == 0 || !strings.HasSuffix(p.Segments[len(p.Segments)-1].Path, "/")):
+			return nil, newRouteError("", path, pos, "optional param '"+str+"' must be a whole segment")
+		case optional && !seg.Optional:
+			return nil, newRouteError("", path, pos, "param '"+str+"' after optional param must be optional")
+		}
+		optional = optional || seg.Optional
+		p.Segments = append(p.Segments, seg)
+		pos += len(str)
+	}
+	return p, nil
+}
+
+// Create a segment from the path cut by getSplitPath, the optional marker ':name?' or ':name=value' and the braces of '{:name}' are removed from the path.
+//
+// 使用getSplitPath切割的路径创建片段，从路径删除可选标记':name?'或':name=value'和'{:name}'的括号。
+func newPatternSegment(path string, pos int) PatternSegment {
+	seg := PatternSegment{Kind: PatternConst, Path: path, Pos: pos}
+	switch path[0] {
+	case '{':
+		// 括号内的参数，删除括号
+		if len(path) > 2 && path[1] == ':' && path[len(path)-1] == '}' {
+			return newPatternSegment(path[1:len(path)-1], pos)
+		}
+	case ':':
+		seg.Kind = PatternParam
+		seg.Name = path[1:]
+		if i := strings.IndexByte(seg.Name, '|'); i != -1 {
+			seg.Kind, seg.Name, seg.Check = PatternRegexParam, seg.Name[:i], seg.Name[i+1:]
+		}
+		// '?'后带有其他字符不是可选参数
+		i := strings.IndexAny(seg.Name, "?=")
+		if i == -1 || (seg.Name[i] == '?' && i != len(seg.Name)-1) {
+			return seg
+		}
+		if seg.Name[i] == '=' {
+			seg.Default = seg.Name[i+1:]
+		}
+		seg.Optional, seg.Name = true, seg.Name[:i]
+		seg.Path = ":" + seg.Name
+		if seg.Kind == PatternRegexParam {
+			seg.Path += "|" + seg.Check
+		}
+	case '*':
+		seg.Kind = PatternWildcard
+		seg.Name = path[1:]
+		if i := strings.IndexByte(seg.Name, '|'); i != -1 {
+			seg.Kind, seg.Name, seg.Check = PatternValidWildcard, seg.Name[:i], seg.Name[i+1:]
+		}
+		if len(seg.Name) == 0 {
+			seg.Name = "*"
+		}
+	}
+	return seg
+}
+
+// Lowercase the ASCII letters of the constant segments, used by the case-insensitive routers.
+//
+// 转换常量片段的ASCII字母为小写，用于忽略大小写的路由器。
+func (p *Pattern) lowerConst() {
+	for i := range p.Segments {
+		if p.Segments[i].Kind == PatternConst {
+			p.Segments[i].Path = lowerASCII(p.Segments[i].Path)
+		}
+	}
+}
+
+// Get the route args of the pattern, the first is the path, and the others are the tags.
+//
+// 获取路由模式的路由参数，第一个为路径，其他为标签。
+func (p *Pattern) args() []string {
+	args := make([]string, 1, len(p.Tags)+1)
+	args[0] = p.Path
+	for _, tag := range p.Tags {
+		args = append(args, tag.Name+"="+tag.Value)
+	}
+	return args
+}
+
+// Expand the paths of the pattern, the trailing optional params are absent one by one.
+//
+// The paths are returned from the shortest to the full path, the default values are used by all the paths that lack the param.
+//
+// 展开路由模式的路径，末尾的可选参数依次缺省。
+//
+// 按照从最短路径到完整路径的顺序返回，默认值用于缺省该参数的全部路径。
+func (p *Pattern) expand() []patternPath {
+	var paths []patternPath
+	for i, seg := range p.Segments {
+		if !seg.Optional {
+			continue
+		}
+		// 删除可选参数前常量末尾的'/'
+		segs := append([]PatternSegment{}, p.Segments[:i]...)
+		last := &segs[len(segs)-1]
+		last.Path = strings.TrimSuffix(last.Path, "/")
+		if len(last.Path) == 0 {
+			if len(segs) == 1 {
+				last.Path = "/"
+			} else {
+				segs = segs[:len(segs)-1]
+			}
+		}
+		paths = append(paths, patternPath{segments: segs})
+		if len(seg.Default) != 0 {
+			for j := range paths {
+				paths[j].defaults = append(paths[j].defaults, seg.Name+"="+seg.Default)
+			}
+		}
+	}
+	return append(paths, patternPath{segments: p.Segments})
+}
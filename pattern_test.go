@@ -0,0 +1,81 @@
+package erouter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	for key, want := range map[string]Pattern{
+		"/": {Path: "/", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/"},
+		}},
+		"/files/:name.:ext name=file": {Path: "/files/:name.:ext", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/files/"},
+			{Kind: PatternParam, Path: ":name", Name: "name", Pos: 7},
+			{Kind: PatternConst, Path: ".", Pos: 12},
+			{Kind: PatternParam, Path: ":ext", Name: "ext", Pos: 13},
+		}, Tags: []PatternTag{{Name: "name", Value: "file", Pos: 18}}},
+		`/d/:date|^\d{4} \d{2}$ k="a b"`: {Path: `/d/:date|^\d{4} \d{2}$`, Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/d/"},
+			{Kind: PatternRegexParam, Path: `:date|^\d{4} \d{2}$`, Name: "date", Check: `^\d{4} \d{2}$`, Pos: 3},
+		}, Tags: []PatternTag{{Name: "k", Value: "a b", Pos: 23}}},
+		`/r/:id|^a{2,3}$/*`: {Path: `/r/:id|^a{2,3}$/*`, Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/r/"},
+			{Kind: PatternRegexParam, Path: ":id|^a{2,3}$", Name: "id", Check: "^a{2,3}$", Pos: 3},
+			{Kind: PatternConst, Path: "/", Pos: 15},
+			{Kind: PatternWildcard, Path: "*", Name: "*", Pos: 16},
+		}},
+		"/files/:name|alpha.:ext": {Path: "/files/:name|alpha.:ext", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/files/"},
+			{Kind: PatternRegexParam, Path: ":name|alpha", Name: "name", Check: "alpha", Pos: 7},
+			{Kind: PatternConst, Path: ".", Pos: 18},
+			{Kind: PatternParam, Path: ":ext", Name: "ext", Pos: 19},
+		}},
+		"/files/:name|suffix:.png": {Path: "/files/:name|suffix:.png", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/files/"},
+			{Kind: PatternRegexParam, Path: ":name|suffix:.png", Name: "name", Check: "suffix:.png", Pos: 7},
+		}},
+		"/static/*path|prefix:img": {Path: "/static/*path|prefix:img", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/static/"},
+			{Kind: PatternValidWildcard, Path: "*path|prefix:img", Name: "path", Check: "prefix:img", Pos: 8},
+		}},
+		"/list/:page=1|isnum": {Path: "/list/:page=1|isnum", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/list/"},
+			{Kind: PatternRegexParam, Path: ":page|isnum", Name: "page", Check: "isnum", Optional: true, Default: "1", Pos: 6},
+		}},
+		"/archive/:year?/:month?": {Path: "/archive/:year?/:month?", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/archive/"},
+			{Kind: PatternParam, Path: ":year", Name: "year", Optional: true, Pos: 9},
+			{Kind: PatternConst, Path: "/", Pos: 15},
+			{Kind: PatternParam, Path: ":month", Name: "month", Optional: true, Pos: 16},
+		}},
+		"/v{:version}/items": {Path: "/v{:version}/items", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/v"},
+			{Kind: PatternParam, Path: ":version", Name: "version", Pos: 2},
+			{Kind: PatternConst, Path: "/items", Pos: 12},
+		}},
+		"/x:a?": {Path: "/x:a?", Segments: []PatternSegment{
+			{Kind: PatternConst, Path: "/x:a?"},
+		}},
+	} {
+		p, err := ParsePattern(key)
+		if err != nil || !reflect.DeepEqual(*p, want) {
+			t.Errorf("%s: %#v %v, want %#v", key, p, err, want)
+		}
+	}
+}
+
+func TestParsePatternError(t *testing.T) {
+	for key, pos := range map[string]int{
+		"/x/:a?/b":  6,
+		"/x/:a?b":   3,
+		"/x/:=1":    3,
+		"/x/:a?/:b": 7,
+	} {
+		_, err := ParsePattern(key)
+		if e, ok := err.(*RouteError); !ok || e.Position != pos {
+			t.Errorf("%s: %v, want an error at position %d", key, err, pos)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package erouter
+
+/*
+HEAD请求使用GET处理时丢弃响应body的ResponseWriter。
+*/
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+type (
+	// responseWriterHead discard the response body and record its length, header and Content-Length are kept.
+	//
+	// responseWriterHead丢弃响应body并记录长度，保留header和Content-Length。
+	responseWriterHead struct {
+		http.ResponseWriter
+		size        int
+		status      int
+		wroteHeader bool
+	}
+	// 按照原ResponseWriter实现的接口组合，使处理者无法区分包装。
+	responseFlusherHead struct {
+		w *responseWriterHead
+	}
+	responseHijackerHead struct {
+		w *responseWriterHead
+	}
+	responsePusherHead struct {
+		w *responseWriterHead
+	}
+)
+
+// Create a Handler that processes HEAD requests with the handler of GET.
+//
+// 创建一个使用GET处理者处理HEAD请求的Handler，响应body会被丢弃。
+func newHandlerHead(h Handler) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		rw, hw := newResponseWriterHead(w)
+		h(rw, req, p)
+		hw.writeHeader(true)
+	}
+}
+
+// Create a responseWriterHead, the returned ResponseWriter implements the same interfaces as w.
+//
+// 创建一个responseWriterHead，返回的ResponseWriter和w实现相同的Flusher、Hijacker、Pusher接口。
+func newResponseWriterHead(w http.ResponseWriter) (http.ResponseWriter, *responseWriterHead) {
+	hw := &responseWriterHead{ResponseWriter: w}
+	_, f := w.(http.Flusher)
+	_, h := w.(http.Hijacker)
+	_, p := w.(http.Pusher)
+	switch {
+	case f && h && p:
+		return struct {
+			*responseWriterHead
+			responseFlusherHead
+			responseHijackerHead
+			responsePusherHead
+		}{hw, responseFlusherHead{hw}, responseHijackerHead{hw}, responsePusherHead{hw}}, hw
+	case f && h:
+		return struct {
+			*responseWriterHead
+			responseFlusherHead
+			responseHijackerHead
+		}{hw, responseFlusherHead{hw}, responseHijackerHead{hw}}, hw
+	case f && p:
+		return struct {
+			*responseWriterHead
+			responseFlusherHead
+			responsePusherHead
+		}{hw, responseFlusherHead{hw}, responsePusherHead{hw}}, hw
+	case h && p:
+		return struct {
+			*responseWriterHead
+			responseHijackerHead
+			responsePusherHead
+		}{hw, responseHijackerHead{hw}, responsePusherHead{hw}}, hw
+	case f:
+		return struct {
+			*responseWriterHead
+			responseFlusherHead
+		}{hw, responseFlusherHead{hw}}, hw
+	case h:
+		return struct {
+			*responseWriterHead
+			responseHijackerHead
+		}{hw, responseHijackerHead{hw}}, hw
+	case p:
+		return struct {
+			*responseWriterHead
+			responsePusherHead
+		}{hw, responsePusherHead{hw}}, hw
+	}
+	return hw, hw
+}
+
+// WriteHeader 记录响应状态码，在处理结束或Flush时写入。
+func (w *responseWriterHead) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+// Write 丢弃写入的数据，仅记录长度。
+func (w *responseWriterHead) Write(b []byte) (int, error) {
+	w.WriteHeader(200)
+	w.size += len(b)
+	return len(b), nil
+}
+
+// WriteString 丢弃写入的字符串，仅记录长度。
+func (w *responseWriterHead) WriteString(s string) (int, error) {
+	w.WriteHeader(200)
+	w.size += len(s)
+	return len(s), nil
+}
+
+// ReadFrom 丢弃读取的数据，仅记录长度，实现io.ReaderFrom。
+func (w *responseWriterHead) ReadFrom(r io.Reader) (int64, error) {
+	w.WriteHeader(200)
+	n, err := io.Copy(ioutil.Discard, r)
+	w.size += int(n)
+	return n, err
+}
+
+// Unwrap 返回原ResponseWriter，用于http.ResponseController访问原ResponseWriter。
+func (w *responseWriterHead) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Write the status code to the original ResponseWriter, if done is true and Content-Length is not set, set it to the discarded body length.
+//
+// 向原ResponseWriter写入状态码，如果done为true并且未设置Content-Length，设置为丢弃body的长度。
+func (w *responseWriterHead) writeHeader(done bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = 200
+	}
+	h := w.ResponseWriter.Header()
+	if done && w.size > 0 && h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" {
+		h.Set("Content-Length", strconv.Itoa(w.size))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Flush 写入状态码并刷新原ResponseWriter。
+func (f responseFlusherHead) Flush() {
+	f.w.writeHeader(false)
+	f.w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack 劫持原ResponseWriter的连接，之后不再写入状态码。
+func (h responseHijackerHead) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.w.wroteHeader = true
+	return h.w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Push 使用原ResponseWriter进行http2推送。
+func (p responsePusherHead) Push(target string, opts *http.PushOptions) error {
+	return p.w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
@@ -0,0 +1,45 @@
+package erouter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriterHead(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.ImplicitHead, full.ImplicitHead = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/file", func(w http.ResponseWriter, req *http.Request, p Params) {
+			if _, ok := w.(io.ReaderFrom); !ok {
+				t.Errorf("%T ResponseWriter does not implement io.ReaderFrom", r)
+			}
+			if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() == w {
+				t.Errorf("%T ResponseWriter does not unwrap the original ResponseWriter", r)
+			}
+			io.Copy(w, strings.NewReader("hello"))
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("HEAD", "/file", nil))
+		if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "5" {
+			t.Errorf("%T HEAD /file: %d %q Content-Length %q", r, w.Code, w.Body.String(), w.Header().Get("Content-Length"))
+		}
+	}
+}
+
+func TestRouterImplicitHeadWithoutTree(t *testing.T) {
+	defer func(methods []string) {
+		RouterAllMethod = methods
+	}(RouterAllMethod)
+	RouterAllMethod = []string{MethodGet}
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.ImplicitHead, full.ImplicitHead = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/a", newTestHandler())
+		if code, body := doTestRequest(r, "HEAD", "/a"); code != 200 || body != "" {
+			t.Errorf("%T HEAD /a: %d %q, want 200", r, code, body)
+		}
+	}
+}
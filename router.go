@@ -1,8 +1,21 @@
 package erouter
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	pathpkg "path"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 路由重定向策略
+const (
+	redirectKindSlash uint8 = 1 << iota
+	redirectKindFixed
+	redirectKindCase
 )
 
 // 默认http请求方法
@@ -39,6 +52,7 @@ type (
 		AddMiddleware(string, string, ...Middleware) RouterMethod
 		NotFound(Handler)
 		MethodNotAllowed(Handler)
+		NotAcceptable(Handler)
 		Any(string, Handler)
 		Delete(string, Handler)
 		Get(string, Handler)
@@ -52,10 +66,54 @@ type (
 	//
 	// 路由器核心接口，执行路由、中间件的注册和处理http请求。
 	RouterCore interface {
-		RegisterMiddleware(string, string, []Middleware)
-		RegisterHandler(string, string, Handler)
+		RegisterMiddleware(string, string, []Middleware) error
+		RegisterHandler(string, string, Handler) error
+		RemoveMiddleware(string, string, string)
+		RemoveHandler(string, string)
+		ReplaceHandler(string, string, Handler)
+		Routes() []RouteInfo
+		URL(string, ...string) (string, error)
+		Err() error
 		ServeHTTP(http.ResponseWriter, *http.Request)
 	}
+	// RouteInfo is the information of a registered route.
+	//
+	// RouteInfo是一个已注册路由的信息。
+	RouteInfo struct {
+		Method string
+		// 完整路由路径
+		Path string
+		// 默认参数，不包含route
+		Tags map[string]string
+		// 参数名称，按照路径顺序
+		Params []string
+		// 参数名称对应的校验函数，仅RouterFull使用
+		Checks map[string]string
+		// 是否由Any注册
+		Any bool
+		// 处理者使用的中间件数量
+		Middlewares int
+		// RouterHost匹配的Host，默认子路由器为空
+		Host string
+	}
+	// RouteError is the error of a route registration, containing the method, pattern, position and reason.
+	//
+	// RouteError是路由注册的错误，包含方法、路由模式、错误位置和原因。
+	RouteError struct {
+		Method  string
+		Pattern string
+		// 错误路径片段在Pattern中的偏移，-1表示整个路由
+		Position int
+		Reason   string
+	}
+	// RouteErrors is the registration errors collected by the router.
+	//
+	// RouteErrors是路由器收集的注册错误。
+	RouteErrors []*RouteError
+	// routeNameError is the error that the route name is not registered.
+	//
+	// routeNameError是路由名称未注册的错误。
+	routeNameError string
 	// Router interface needs to implement two methods: the router method and the router core.
 	//
 	// 路由器接口，需要实现路由器方法、路由器核心两个接口。
@@ -65,14 +123,42 @@ type (
 	}
 )
 
+// 路由器包所在目录，获取注册位置时跳过
+var routerPackageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return pathpkg.Dir(file)
+}()
+
 var (
 	// ParamRoute 是路由参数键值
 	ParamRoute = "route"
+	// ParamAllow 是405处理时当前路径允许方法的参数键值
+	ParamAllow = "allow"
+	// ParamRedirect 是路由重定向策略的参数键值，值为逗号分隔的slash、fixed，其他值关闭重定向
+	ParamRedirect = "redirect"
+	// ParamName 是路由名称的参数键值，用于URL方法创建url
+	ParamName = "name"
+	// ParamMwname 是中间件名称的参数键值，用于skip标签排除和RemoveMiddleware删除中间件
+	ParamMwname = "mwname"
+	// ParamSkip 是路由排除中间件的参数键值，值为逗号分隔的中间件名称
+	ParamSkip = "skip"
+	// ParamProduces 是路由产生的媒体类型的参数键值，匹配后为协商选择的媒体类型，406处理时为可产生的媒体类型
+	ParamProduces = "produces"
 	// Page404 是404返回的body
 	Page404 = []byte("404 page not found\n")
 	// Page405 是405返回的body
 	Page405 = []byte("405 method not allowed\n")
-	// RouterAllMethod 是默认Any的全部方法
+	// Page406 是406返回的body
+	Page406 = []byte("406 not acceptable\n")
+	// RouterProducesExtension 是路径扩展名对应的媒体类型，内容协商时覆盖Accept Header
+	RouterProducesExtension = map[string]string{
+		".json": "application/json",
+		".csv":  "text/csv",
+		".html": "text/html",
+		".xml":  "application/xml",
+		".txt":  "text/plain",
+	}
+	// RouterAllMethod 是默认Any的全部方法，路由器创建时复制为AnyMethods
 	RouterAllMethod              = []string{MethodGet, MethodPost, MethodPut, MethodDelete, MethodHead, MethodPatch, MethodOptions}
 	_               Params       = (*ParamsArray)(nil)
 	_               RouterMethod = (*RouterMethodStd)(nil)
@@ -117,14 +203,1048 @@ func CombineHandler(handler Handler, m []Middleware) Handler {
 }
 
 // 默认405处理，返回405状态码和允许的方法
+//
+// 允许的方法从allow参数读取。
 func defaultRouter405Func(w http.ResponseWriter, req *http.Request, param Params) {
-	w.Header().Add("Allow", strings.Join(RouterAllMethod, ", "))
+	w.Header().Add("Allow", param.GetParam(ParamAllow))
 	w.WriteHeader(405)
 	w.Write(Page405)
 }
 
+// 默认OPTIONS处理，返回204状态码和允许的方法
+func defaultRouterOptionsFunc(w http.ResponseWriter, req *http.Request, param Params) {
+	w.Header().Add("Allow", param.GetParam(ParamAllow))
+	w.WriteHeader(204)
+}
+
 // 默认404处理，返回404状态码
 func defaultRouter404Func(w http.ResponseWriter, req *http.Request, param Params) {
 	w.WriteHeader(404)
 	w.Write(Page404)
 }
+
+// 默认406处理，返回406状态码
+func defaultRouter406Func(w http.ResponseWriter, req *http.Request, param Params) {
+	w.WriteHeader(406)
+	w.Write(Page406)
+}
+
+// 重定向路径和使用的策略
+type redirectPath struct {
+	path string
+	kind uint8
+}
+
+// Get the redirect paths that toggled the trailing slash or cleaned of the path, the paths that can redirect to other hosts are ignored.
+//
+// 获取路径切换末尾'/'或清理后的重定向路径，忽略可以重定向到其他主机的路径。
+func getRedirectPaths(path string) []redirectPath {
+	var paths []redirectPath
+	if path != "/" && isSafeRedirect(path) {
+		paths = append(paths, redirectPath{toggleTrailingSlash(path), redirectKindSlash})
+	}
+	if fixed := cleanPath(path); fixed != path && isSafeRedirect(fixed) {
+		paths = append(paths, redirectPath{fixed, redirectKindFixed})
+		if fixed != "/" {
+			paths = append(paths, redirectPath{toggleTrailingSlash(fixed), redirectKindSlash | redirectKindFixed})
+		}
+	}
+	return paths
+}
+
+// Whether the redirect path stays on the current host, the browser treats the path starting with "//" or "/\\" as another host.
+//
+// 重定向路径是否保持在当前主机，浏览器会将"//"或"/\\"开头的路径视为其他主机。
+func isSafeRedirect(path string) bool {
+	return len(path) < 2 || (path[1] != '/' && path[1] != '\\')
+}
+
+// Get the redirect policy from the redirect tag, if the tag is empty use the router default policy.
+//
+// 从redirect标签获取重定向策略，如果标签为空使用路由器默认策略。
+func getRedirectPolicy(tag string, slash, fixed, cased bool) uint8 {
+	var kind uint8
+	if len(tag) == 0 {
+		if slash {
+			kind |= redirectKindSlash
+		}
+		if fixed {
+			kind |= redirectKindFixed
+		}
+		if cased {
+			kind |= redirectKindCase
+		}
+		return kind
+	}
+	for _, i := range strings.Split(tag, ",") {
+		switch i {
+		case "slash":
+			kind |= redirectKindSlash
+		case "fixed":
+			kind |= redirectKindFixed
+		case "case":
+			kind |= redirectKindCase
+		}
+	}
+	return kind
+}
+
+// 创建一个重定向处理，GET请求返回301，其他请求返回308，重定向路径使用请求的转义规则转义，保留请求的查询参数。
+func newHandlerRedirect(path string) Handler {
+	return func(w http.ResponseWriter, req *http.Request, param Params) {
+		code := 308
+		if req.Method == MethodGet {
+			code = 301
+		}
+		target := getRedirectEscapedPath(req.URL, path)
+		if len(req.URL.RawQuery) != 0 {
+			target += "?" + req.URL.RawQuery
+		}
+		http.Redirect(w, req, target, code)
+	}
+}
+
+// 获取转义后的重定向路径，如果重定向路径是切换末尾'/'或清理请求的路径，使用请求的转义路径处理。
+func getRedirectEscapedPath(u *url.URL, path string) string {
+	escaped := u.EscapedPath()
+	switch path {
+	case u.Path:
+		return escaped
+	case toggleTrailingSlash(u.Path):
+		escaped = toggleTrailingSlash(escaped)
+	case cleanPath(u.Path):
+		escaped = cleanPath(escaped)
+	case toggleTrailingSlash(cleanPath(u.Path)):
+		escaped = toggleTrailingSlash(cleanPath(escaped))
+	default:
+		escaped = (&url.URL{Path: path}).EscapedPath()
+	}
+	if unescaped, err := url.PathUnescape(escaped); err != nil || unescaped != path {
+		escaped = (&url.URL{Path: path}).EscapedPath()
+	}
+	return escaped
+}
+
+// 切换路径末尾的'/'。
+func toggleTrailingSlash(path string) string {
+	if path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// 清理路径中的'.'、'..'和重复的'/'，保留末尾的'/'。
+func cleanPath(path string) string {
+	if len(path) == 0 {
+		return "/"
+	}
+	if path[0] != '/' {
+		path = "/" + path
+	}
+	fixed := pathpkg.Clean(path)
+	if path[len(path)-1] == '/' && fixed != "/" {
+		fixed += "/"
+	}
+	return fixed
+}
+
+// 转换ASCII字母为小写。
+func toLowerASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// 转换字符串中的ASCII字母为小写，其他字符保持不变，不改变字符串长度。
+func lowerASCII(str string) string {
+	for i := 0; i < len(str); i++ {
+		if 'A' <= str[i] && str[i] <= 'Z' {
+			buf := []byte(str)
+			for j := i; j < len(buf); j++ {
+				buf[j] = toLowerASCII(buf[j])
+			}
+			return string(buf)
+		}
+	}
+	return str
+}
+
+// 忽略ASCII字母大小写比较两个字符串是否相等。
+func equalFoldASCII(str1, str2 string) bool {
+	if len(str1) != len(str2) {
+		return false
+	}
+	for i := 0; i < len(str1); i++ {
+		if str1[i] != str2[i] && toLowerASCII(str1[i]) != toLowerASCII(str2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if the method is a valid http token, extension methods such as PROPFIND and PURGE are allowed.
+//
+// 检查方法是否为有效的http token，允许PROPFIND、PURGE等扩展方法。
+func isMethodToken(method string) bool {
+	if len(method) == 0 {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			continue
+		}
+		if strings.IndexByte("!#$%&'*+-.^_`|~", c) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Create a RouteInfo, tags and vals are the default parameters of the node, the first is route.
+//
+// 创建一个RouteInfo，tags和vals为节点的默认参数，第一个为route。
+func newRouteInfo(method string, tags, vals, params, checks []string, isany bool, mnum int) RouteInfo {
+	info := RouteInfo{
+		Method:      method,
+		Tags:        make(map[string]string),
+		Params:      append([]string{}, params...),
+		Any:         isany,
+		Middlewares: mnum,
+	}
+	if len(vals) > 0 {
+		info.Path = vals[0]
+	}
+	for i := 1; i < len(tags); i++ {
+		if _, ok := info.Tags[tags[i]]; !ok {
+			info.Tags[tags[i]] = vals[i]
+		}
+	}
+	for i := range checks {
+		if len(checks[i]) != 0 {
+			if info.Checks == nil {
+				info.Checks = make(map[string]string)
+			}
+			info.Checks[params[i]] = checks[i]
+		}
+	}
+	return info
+}
+
+// Split the route string into the path and tags separated by spaces.
+//
+// In the tags, a double-quoted part keeps spaces and the quotes are removed, such as desc="list all users",
+// '\' escapes a space or a double quote, other backslashes are kept;
+// the path is kept as is, the regular expression in the path may contain spaces.
+//
+// 将路由字符串切割为空格分隔的路径和标签。
+//
+// 标签中双引号内保留空格并删除引号，例如desc="list all users"，'\'转义空格或双引号，其他反斜杠保留；
+// 路径原样保留，路径中的正则表达式可以包含空格。
+func splitRouteArgs(key string) []string {
+	arg, n := scanRouteArg(key, true)
+	args := []string{arg}
+	for key = key[n:]; len(key) != 0; key = key[n:] {
+		if key[0] == ' ' {
+			n = 1
+			continue
+		}
+		arg, n = scanRouteArg(key, false)
+		args = append(args, arg)
+	}
+	return args
+}
+
+// Scan an arg of the route string until an unquoted space, return the unescaped arg and the length scanned,
+// path indicates whether the arg is the path, the path is not unescaped.
+//
+// 扫描路由字符串的一个参数直到未引用的空格，返回反转义的参数和扫描的长度，path表示参数是否为路径，路径不会反转义。
+func scanRouteArg(key string, path bool) (string, int) {
+	var buf []byte
+	var quoted, check, regexp bool
+	// 正则表达式中第一个空格的位置，正则未以'$'结束时在此处结束
+	space, spaceBuf := -1, 0
+	for i := 0; i < len(key); i++ {
+		switch {
+		case check:
+			// 校验中的引号和反斜杠不是语法
+			switch {
+			case key[i] == ' ' && !regexp:
+				return string(buf), i
+			case key[i] == ' ' && space == -1:
+				space, spaceBuf = i, len(buf)
+			case key[i] == '^' && key[i-1] == '|':
+				regexp = true
+			case regexp && key[i] == '$' && key[i-1] != '\\' && (i+1 == len(key) || key[i+1] == '/' || key[i+1] == ' '):
+				regexp, space = false, -1
+			case key[i] == '/' && !regexp:
+				check = false
+			}
+		case key[i] == ' ' && !quoted:
+			return string(buf), i
+		case path:
+			// 路径中的引号和反斜杠不是语法
+			check = key[i] == '|'
+		case key[i] == '\\' && i+1 < len(key) && (key[i+1] == ' ' || key[i+1] == '"'):
+			i++
+		case key[i] == '"':
+			quoted = !quoted
+			continue
+		}
+		buf = append(buf, key[i])
+	}
+	if regexp && space != -1 {
+		return string(buf[:spaceBuf]), space
+	}
+	return string(buf), len(key)
+}
+
+// Get the route name from the route args, the tags of the route take precedence over the tags of the Group.
+//
+// 从路由参数获取路由名称，路由的标签优先于Group的标签。
+func getRouteName(args []string) string {
+	return getRouteTag(args, ParamName)
+}
+
+// Get the value of the tag from the route args, the first one takes precedence.
+//
+// 从路由参数获取标签的值，第一个优先。
+func getRouteTag(args []string, tag string) string {
+	for _, str := range args[1:] {
+		key, val := split2byte(str, '=')
+		if key == tag {
+			return val
+		}
+	}
+	return ""
+}
+
+// Get the value of the tag from the tags and vals of the node, the first one takes precedence.
+//
+// 从节点的tags和vals获取标签的值，第一个优先。
+func getTagValue(tags, vals []string, tag string) string {
+	for i := range tags {
+		if tags[i] == tag {
+			return vals[i]
+		}
+	}
+	return ""
+}
+
+// Build the url of the route pattern, args are the parameter names and values in pairs.
+//
+// The parameter values are escaped, and if load is not nil, they are checked by the check functions loaded by RouterFull.
+//
+// 使用路由模式创建url，args为成对的参数名称和值。
+//
+// 参数值会被转义，如果load不为空，使用RouterFull加载的校验函数检查参数值。
+func newRouteURL(pattern string, args []string, load func(string) (string, RouterCheckFunc)) (string, error) {
+	if len(args)%2 != 0 {
+		return "", fmt.Errorf("route url args must be name and value pairs, got %d args", len(args))
+	}
+	var buf strings.Builder
+	for _, path := range getSplitPath(pattern) {
+		seg := newPatternSegment(path, 0)
+		if seg.Kind == PatternConst {
+			buf.WriteString(path)
+			continue
+		}
+		name := seg.Name
+		var fn RouterCheckFunc
+		if load != nil && len(seg.Check) != 0 {
+			_, fn = load(seg.Path)
+		}
+		val, ok := getRouteURLArg(args, name)
+		if !ok && seg.Optional {
+			// 缺少的可选参数省略剩余的路径段
+			str := strings.TrimSuffix(buf.String(), "/")
+			if len(str) == 0 {
+				str = "/"
+			}
+			return str, nil
+		}
+		if !ok {
+			return "", fmt.Errorf("route '%s' missing param '%s'", pattern, name)
+		}
+		if fn != nil && !fn(val) {
+			return "", fmt.Errorf("route '%s' param '%s' value '%s' check failed", pattern, name, val)
+		}
+		if seg.Kind == PatternParam || seg.Kind == PatternRegexParam {
+			buf.WriteString(url.PathEscape(val))
+			continue
+		}
+		// 通配符保留'/'，分别转义每段
+		for i, str := range strings.Split(val, "/") {
+			if i > 0 {
+				buf.WriteByte('/')
+			}
+			buf.WriteString(url.PathEscape(str))
+		}
+	}
+	return buf.String(), nil
+}
+
+func getRouteURLArg(args []string, name string) (string, bool) {
+	for i := 0; i < len(args); i += 2 {
+		if args[i] == name {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// Error 返回路由名称未注册的错误信息。
+func (name routeNameError) Error() string {
+	return fmt.Sprintf("route name '%s' is not registered", string(name))
+}
+
+// Get the file and line of the registration, the frames in the router package are skipped.
+//
+// 获取注册的文件和行号，跳过路由器包内的调用栈。
+func getCallerSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if pathpkg.Dir(frame.File) != routerPackageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// Create the reason of a route registered repeatedly in strict mode, isany and oldany indicate whether the routes are registered by Any.
+//
+// 创建严格模式下路由重复注册的原因，isany和oldany表示路由是否由Any注册。
+func newStrictDuplicate(source string, isany, oldany bool, oldpath, oldsource string) string {
+	route, reason := "route", "duplicates route"
+	if isany {
+		route = "Any route"
+	}
+	if isany && !oldany {
+		reason = "is shadowed by route"
+	} else if !isany && oldany {
+		reason = "overrides Any route"
+	}
+	return fmt.Sprintf("strict mode: %s at %s %s %s at %s", route, source, reason, oldpath, oldsource)
+}
+
+// Create the reason of a param or wildcard name clash in strict mode.
+//
+// 创建严格模式下参数或通配符名称冲突的原因。
+func newStrictConflict(source, name, oldname, oldsource string) string {
+	return fmt.Sprintf("strict mode: param '%s' at %s clashes with param '%s' at %s", name, source, oldname, oldsource)
+}
+
+// Create the reason of a route name used by another route in strict mode.
+//
+// 创建严格模式下路由名称被其他路由使用的原因。
+func newStrictName(source, name, oldpath string) string {
+	return fmt.Sprintf("strict mode: route name '%s' at %s is used by route %s", name, source, oldpath)
+}
+
+// Create a RouteError, pos is the offset of the path segment in the pattern, -1 is the whole route.
+//
+// 创建一个RouteError，pos为路径片段在pattern中的偏移，-1表示整个路由。
+func newRouteError(method, pattern string, pos int, reason string) *RouteError {
+	return &RouteError{
+		Method:   method,
+		Pattern:  pattern,
+		Position: pos,
+		Reason:   reason,
+	}
+}
+
+// Error 返回路由注册错误的信息。
+func (e *RouteError) Error() string {
+	if len(e.Method) == 0 {
+		return fmt.Sprintf("route %s error at position %d: %s", e.Pattern, e.Position, e.Reason)
+	}
+	if e.Position < 0 {
+		return fmt.Sprintf("register route %s %s error: %s", e.Method, e.Pattern, e.Reason)
+	}
+	return fmt.Sprintf("register route %s %s error at position %d: %s", e.Method, e.Pattern, e.Position, e.Reason)
+}
+
+// Error 返回全部路由注册错误的信息，每行一个。
+func (errs RouteErrors) Error() string {
+	strs := make([]string, len(errs))
+	for i, err := range errs {
+		strs[i] = err.Error()
+	}
+	return strings.Join(strs, "\n")
+}
+
+type (
+	// 路由器共用的路由数据和注册状态，RouterRadix和RouterFull嵌入使用
+	routerStore struct {
+		// routing data, replaced atomically when modified
+		// 路由数据，修改时使用原子操作替换
+		trees atomic.Value
+		batch *routerTrees
+		mu    sync.Mutex
+		// 注册失败的错误
+		errs RouteErrors
+	}
+	// 路由器的路由数据，包含中间件、异常处理和各种方法路由树
+	routerTrees struct {
+		// save middleware
+		// 保存注册的中间件信息
+		middtree *middTree
+		// exception handling node
+		// 异常处理节点
+		node404 routeData
+		node405 routeData
+		node406 routeData
+		// various methods routing tree
+		// 各种方法路由树
+		methods []string
+		trees   []routeNode
+		// 路由名称对应的路由模式
+		names map[string]string
+		// 路由redirect标签使用过的重定向策略
+		redirect uint8
+	}
+	// 路由树节点，由radixNode和fullNode实现，路由器共用的匹配和修改使用该接口
+	routeNode interface {
+		getRouteData() *routeData
+		cloneNode() routeNode
+		findNode(string, []routeNode) []routeNode
+		isEmpty() bool
+		deleteNode(routeNode)
+		mergeNode()
+		recursiveLoopup(string, Params, bool) Handler
+		recursiveCasePath(string, []byte) bool
+		recursiveCombine(string, *middTree, Handler, Handler)
+		getRoutes(string, []RouteInfo) []RouteInfo
+	}
+	// 路由节点的路由数据，radixNode和fullNode共用
+	routeData struct {
+		// 默认标签的名称和值
+		tags []string
+		vals []string
+		// 路由匹配的处理者，注册的原始处理者和使用的中间件数量，中间件变化时重新组合handlers
+		handlers Handler
+		handler  Handler
+		mnum     int
+		// 处理者是否由Any注册
+		isany bool
+		// 带有header、query、cookie或produces约束的处理者，按照注册顺序匹配，produces为可产生的媒体类型
+		guards   []*routeGuard
+		produces string
+		// 严格模式下创建节点或设置处理者的注册位置
+		source string
+	}
+	// 路由器匹配请求使用的配置
+	routerOptions struct {
+		fold    bool
+		head    bool
+		options bool
+		slash   bool
+		fixed   bool
+		cased   bool
+	}
+)
+
+// Lock and get the routing data to be modified.
+//
+// In batch, return the batch data; if cow is true, return a copy; otherwise return the routing data in use.
+//
+// 加锁并获取需要修改的路由数据。
+//
+// 批量注册时返回批量数据；如果cow为true返回副本；否则返回正在使用的路由数据。
+func (s *routerStore) lockTrees(cow bool) *routerTrees {
+	s.mu.Lock()
+	if s.batch != nil {
+		return s.batch
+	}
+	trees := s.trees.Load().(*routerTrees)
+	if cow {
+		return trees.clone()
+	}
+	return trees
+}
+
+// Replace the routing data atomically and unlock, in batch the routing data is replaced when the batch ends.
+//
+// 使用原子操作替换路由数据并解锁，批量注册时在批量结束时替换。
+func (s *routerStore) unlockTrees(trees *routerTrees) {
+	if s.batch == nil {
+		s.trees.Store(trees)
+	}
+	s.mu.Unlock()
+}
+
+// Run fn on a copy of the routing data and replace the routing data atomically once fn returns, if fn panics the batch is discarded.
+//
+// 在路由数据的副本上执行fn，fn返回后使用一次原子操作替换路由数据，如果fn发生panic，批量会被丢弃。
+func (s *routerStore) batchTrees(fn func()) {
+	s.mu.Lock()
+	if s.batch != nil {
+		s.mu.Unlock()
+		fn()
+		return
+	}
+	s.batch = s.trees.Load().(*routerTrees).clone()
+	s.mu.Unlock()
+
+	done := false
+	defer func() {
+		s.mu.Lock()
+		if done {
+			s.batch.combineHandlers(s.handle404, s.handle406)
+			s.trees.Store(s.batch)
+		}
+		s.batch = nil
+		s.mu.Unlock()
+	}()
+	fn()
+	done = true
+}
+
+// Err method returns the errors of all failed registrations, and returns nil if there are none.
+//
+// Err返回全部注册失败的错误，没有错误返回nil。
+func (s *routerStore) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return append(RouteErrors{}, s.errs...)
+}
+
+// Record a registration error, the lock must be held.
+//
+// 记录一个注册错误，调用时需要持有锁。
+func (s *routerStore) addError(err *RouteError) error {
+	if err == nil {
+		return nil
+	}
+	s.errs = append(s.errs, err)
+	return err
+}
+
+// Combine the handlers of all routes after the middleware tree is modified, in batch they are combined once when the batch ends.
+//
+// 修改中间件树后重新组合全部路由的处理者，批量注册时在批量结束后组合一次。
+func (s *routerStore) combineHandlers(trees *routerTrees) {
+	if s.batch == nil {
+		trees.combineHandlers(s.handle404, s.handle406)
+	}
+}
+
+// Handle the request with node404, used when no guard of the route matches and there is no fallback.
+//
+// 使用node404处理请求，在路由没有约束处理者匹配并且没有默认处理者时使用。
+func (s *routerStore) handle404(w http.ResponseWriter, req *http.Request, p Params) {
+	node404 := &s.trees.Load().(*routerTrees).node404
+	node404.AddTagsToParams(p)
+	node404.handlers(w, req, p)
+}
+
+// Handle the request with node406, used when the route produces no media type acceptable by the request.
+//
+// 使用node406处理请求，在路由产生的媒体类型都不被请求接受时使用。
+func (s *routerStore) handle406(w http.ResponseWriter, req *http.Request, p Params) {
+	node406 := &s.trees.Load().(*routerTrees).node406
+	node406.AddTagsToParams(p)
+	node406.handlers(w, req, p)
+}
+
+// Routes method returns the information of all registered routes, sorted by method and matching order.
+//
+// Routes返回全部注册路由的信息，按照方法和匹配顺序排序。
+func (s *routerStore) Routes() []RouteInfo {
+	trees := s.trees.Load().(*routerTrees)
+	var routes []RouteInfo
+	for i, method := range trees.methods {
+		routes = trees.trees[i].getRoutes(method, routes)
+	}
+	return routes
+}
+
+// Remove or replace the route in the routing data, ANY method modifies the routes registered by Any for each method of anys, then reset the route names.
+//
+// 删除或替换路由数据中的路由，ANY方法修改anys每个方法中Any注册的路由，然后重新设置路由名称。
+func (s *routerStore) modifyRoutes(trees *routerTrees, anys []string, method, key string, fold bool, handler Handler) {
+	if method == MethodAny {
+		for _, method := range anys {
+			trees.modifyRoute(method, key, true, fold, handler, s.handle404, s.handle406)
+		}
+	} else {
+		trees.modifyRoute(method, key, false, fold, handler, s.handle404, s.handle406)
+	}
+	trees.resetNames()
+}
+
+// Get the tree of the corresponding method, return nil if the method tree does not exist.
+//
+// 获取对应方法的树，如果方法树不存在返回空。
+func (t *routerTrees) getTree(method string) routeNode {
+	for i, m := range t.methods {
+		if m == method {
+			return t.trees[i]
+		}
+	}
+	return nil
+}
+
+// Add the tree of the method, the method trees are created on demand when the route is registered.
+//
+// 添加一个方法的树，方法树在注册路由时按需创建。
+func (t *routerTrees) newTree(method string, tree routeNode) {
+	t.methods = append(t.methods, method)
+	t.trees = append(t.trees, tree)
+}
+
+// Deep copy the routing data, the middleware tree and all method trees are copied.
+//
+// 深复制路由数据，会复制中间件树和全部方法树。
+func (t *routerTrees) clone() *routerTrees {
+	newTrees := &routerTrees{
+		middtree: t.middtree.clone(),
+		node404:  t.node404,
+		node405:  t.node405,
+		node406:  t.node406,
+		methods:  append([]string{}, t.methods...),
+		trees:    make([]routeNode, len(t.trees)),
+		names:    make(map[string]string, len(t.names)),
+		redirect: t.redirect,
+	}
+	for name, pattern := range t.names {
+		newTrees.names[name] = pattern
+	}
+	for i := range t.trees {
+		newTrees.trees[i] = t.trees[i].cloneNode()
+	}
+	return newTrees
+}
+
+// Combine the handlers of all routes with the middlewares again, called after the middleware tree is modified.
+//
+// 使用中间件重新组合全部路由的处理者，在修改中间件树后调用，使中间件不依赖注册顺序。
+func (t *routerTrees) combineHandlers(notfound, notacceptable Handler) {
+	for i, method := range t.methods {
+		t.trees[i].recursiveCombine(method, t.middtree, notfound, notacceptable)
+	}
+}
+
+// Reset the route names from the method trees, called after the routes are removed or replaced.
+//
+// 从方法树重新设置路由名称，在删除或替换路由后调用。
+func (t *routerTrees) resetNames() {
+	t.names = make(map[string]string)
+	for i, method := range t.methods {
+		for _, route := range t.trees[i].getRoutes(method, nil) {
+			if name := route.Tags[ParamName]; len(name) != 0 {
+				t.names[name] = route.Path
+			}
+		}
+	}
+}
+
+// Modify the route node of the copied routing data, if handler is nil, remove the route.
+//
+// The route with constraint tags modifies the guard with the same constraints, the empty nodes are pruned and the nodes are merged.
+//
+// 修改复制的路由数据中的路由节点，如果handler为空则删除路由。
+//
+// 带有约束标签的路由修改约束相同的约束处理者，会裁剪空节点并合并节点。
+func (t *routerTrees) modifyRoute(method, key string, isany, fold bool, handler, notfound, notacceptable Handler) {
+	tree := t.getTree(method)
+	if tree == nil {
+		return
+	}
+	pattern, err := parsePattern(key)
+	if err != nil {
+		return
+	}
+	if fold {
+		pattern.lowerConst()
+	}
+	args := pattern.args()
+	constraints := getRouteConstraints(args)
+	if handler != nil {
+		t.redirect |= getRedirectPolicy(getRouteTag(args, ParamRedirect), false, false, false)
+	}
+	for _, optional := range pattern.expand() {
+		// 查找节点并记录经过的节点
+		nodes := []routeNode{tree}
+		for _, seg := range optional.segments {
+			nodes = nodes[len(nodes)-1].findNode(seg.Path, nodes)
+			if nodes == nil {
+				break
+			}
+		}
+		if nodes == nil {
+			continue
+		}
+
+		currentNode := nodes[len(nodes)-1].getRouteData()
+		tags := append(args[:len(args):len(args)], optional.defaults...)
+		if len(constraints) != 0 {
+			guard := getRouteGuard(currentNode.guards, constraints)
+			if guard == nil || (isany && !guard.isany) {
+				continue
+			}
+			if handler != nil {
+				currentNode.guards = insertRouteGuard(currentNode.guards, newRouteGuard(tags, constraints, guard.isany, handler, guard.source))
+			} else {
+				currentNode.guards = removeRouteGuard(currentNode.guards, constraints)
+			}
+		} else {
+			if currentNode.handler == nil || (isany && !currentNode.isany) {
+				continue
+			}
+			if handler != nil {
+				currentNode.handler = handler
+				if len(args) > 1 {
+					currentNode.SetTags(tags)
+				}
+			} else {
+				currentNode.isany = false
+				currentNode.handler = nil
+				currentNode.mnum = 0
+			}
+		}
+		currentNode.combine(method, t.middtree, notfound, notacceptable)
+		if currentNode.handlers == nil {
+			currentNode.tags = nil
+			currentNode.vals = nil
+			// 从后向前裁剪空节点并合并节点
+			for i := len(nodes) - 1; i > 0; i-- {
+				if nodes[i].isEmpty() {
+					nodes[i-1].deleteNode(nodes[i])
+				} else {
+					nodes[i].mergeNode()
+				}
+			}
+		}
+	}
+}
+
+// Match a request, if the path matches other methods return node405, no match returns node404.
+//
+// 匹配一个请求，如果路径可以匹配其他方法返回node405，未匹配返回node404。
+//
+// 返回405时会将路径允许的方法使用allow参数保存，如果开启ImplicitHead和AutoOptions，HEAD和OPTIONS请求返回自动处理。
+//
+// 如果切换末尾'/'或清理后的路径可以匹配，并且路由的重定向策略允许，返回重定向处理。
+func (t *routerTrees) match(method, path string, params Params, opts routerOptions) Handler {
+	tree := t.getTree(method)
+	if tree != nil {
+		if n := tree.recursiveLoopup(path, params, opts.fold); n != nil {
+			return n
+		}
+		if n := t.getProduces(tree, path, params, opts); n != nil {
+			return n
+		}
+	}
+
+	// 使用GET处理HEAD，HEAD方法树不存在时同样处理
+	if get := t.getTree(MethodGet); method == MethodHead && opts.head && get != nil {
+		if n := get.recursiveLoopup(path, params, opts.fold); n != nil {
+			return newHandlerHead(n)
+		}
+	}
+
+	if tree != nil {
+		// 处理重定向
+		if n := t.getRedirect(tree, path, opts); n != nil {
+			return n
+		}
+	}
+
+	allow, route := t.getAllow(method, path, opts)
+	// 自动处理OPTIONS，使用匹配路由的模式查找中间件，请求路径不会作为路由语法解析
+	if method == MethodOptions && opts.options && len(allow) != 0 {
+		params.AddParam(ParamAllow, allow)
+		return CombineHandler(defaultRouterOptionsFunc, t.middtree.lookup(method, route, ""))
+	}
+
+	// 处理405
+	if len(allow) != 0 {
+		t.node405.AddTagsToParams(params)
+		params.AddParam(ParamAllow, allow)
+		return t.node405.handlers
+	}
+
+	// 处理404
+	t.node404.AddTagsToParams(params)
+	return t.node404.handlers
+}
+
+// Get the redirect handler if the path that toggled the trailing slash, cleaned or used the case of the registered constants can be matched.
+//
+// The redirect policy is read from the redirect tag of the matched route, the default is RedirectTrailingSlash, RedirectFixedPath and RedirectFixedCase.
+//
+// 如果路径切换末尾'/'、清理或常量使用注册的大小写后可以匹配，返回重定向处理。
+//
+// 重定向策略从匹配路由的redirect标签读取，默认为RedirectTrailingSlash、RedirectFixedPath和RedirectFixedCase。
+func (t *routerTrees) getRedirect(tree routeNode, path string, opts routerOptions) Handler {
+	// 路由器和路由标签都没有的重定向策略不需要处理
+	kind := t.redirect | getRedirectPolicy("", opts.slash, opts.fixed, opts.cased)
+	if kind == 0 {
+		return nil
+	}
+	p := paramArrayPool.Get().(*ParamsArray)
+	defer paramArrayPool.Put(p)
+	if kind&(redirectKindSlash|redirectKindFixed) != 0 {
+		for _, i := range getRedirectPaths(path) {
+			p.Reset()
+			if tree.recursiveLoopup(i.path, p, opts.fold) != nil && getRedirectPolicy(p.GetParam(ParamRedirect), opts.slash, opts.fixed, opts.cased)&i.kind == i.kind {
+				return CombineHandler(newHandlerRedirect(i.path), t.middtree.val)
+			}
+		}
+	}
+	// 忽略大小写时常量已经忽略大小写匹配
+	if opts.fold || kind&redirectKindCase == 0 {
+		return nil
+	}
+	buf := []byte(path)
+	if tree.recursiveCasePath(path, buf) {
+		p.Reset()
+		casePath := string(buf)
+		if casePath != path && isSafeRedirect(casePath) && tree.recursiveLoopup(casePath, p, false) != nil && getRedirectPolicy(p.GetParam(ParamRedirect), opts.slash, opts.fixed, opts.cased)&redirectKindCase == redirectKindCase {
+			return CombineHandler(newHandlerRedirect(casePath), t.middtree.val)
+		}
+	}
+	return nil
+}
+
+// If the path has a known extension and does not match, match the path without the extension, the route must produce the media type of the extension,
+// the media type is set to the produces param, if the route produces other media types return node406.
+//
+// 如果路径带有已知的扩展名并且未匹配，匹配去除扩展名的路径，路由需要产生扩展名对应的媒体类型，媒体类型设置到produces参数，如果路由产生其他媒体类型返回node406。
+func (t *routerTrees) getProduces(tree routeNode, path string, params Params, opts routerOptions) Handler {
+	ext := getPathExtension(path)
+	mime, ok := RouterProducesExtension[ext]
+	if !ok {
+		return nil
+	}
+	p := paramArrayPool.Get().(*ParamsArray)
+	defer paramArrayPool.Put(p)
+	p.Reset()
+	n := tree.recursiveLoopup(path[:len(path)-len(ext)], p, opts.fold)
+	produces := p.GetParam(ParamProduces)
+	switch {
+	case n == nil || len(produces) == 0:
+		return nil
+	case !hasProduces(produces, mime):
+		t.node406.AddTagsToParams(params)
+		return t.node406.handlers
+	}
+	for i := range p.Keys {
+		params.AddParam(p.Keys[i], p.Vals[i])
+	}
+	params.SetParam(ParamProduces, mime)
+	return n
+}
+
+// Get the methods registered by the path in other method trees, separated by ", ", and the pattern of the first matched route.
+//
+// 获取路径在其他方法树中注册的方法，使用", "分隔，和第一个匹配路由的模式。
+//
+// 如果开启ImplicitHead，GET匹配时包含HEAD方法；如果开启AutoOptions，非空结果会包含OPTIONS方法。
+func (t *routerTrees) getAllow(method, path string, opts routerOptions) (string, string) {
+	var allow []string
+	var options bool
+	var route string
+	p := paramArrayPool.Get().(*ParamsArray)
+	get := t.getTree(MethodGet)
+	for i, m := range t.methods {
+		tree := t.trees[i]
+		if m == method {
+			continue
+		}
+		p.Reset()
+		if tree.recursiveLoopup(path, p, opts.fold) != nil || (m == MethodHead && opts.head && get != nil && get.recursiveLoopup(path, p, opts.fold) != nil) {
+			if len(allow) == 0 {
+				route = p.GetParam(ParamRoute)
+			}
+			allow = append(allow, m)
+			options = options || m == MethodOptions
+		}
+	}
+	paramArrayPool.Put(p)
+	if opts.options && !options && len(allow) != 0 {
+		allow = append(allow, MethodOptions)
+	}
+	return strings.Join(allow, ", "), route
+}
+
+// Get the route data of the node.
+//
+// 获取节点的路由数据。
+func (r *routeData) getRouteData() *routeData {
+	return r
+}
+
+// Set the tags for the current Node
+//
+// 给当前Node设置tags
+func (r *routeData) SetTags(args []string) {
+	if len(args) == 0 {
+		return
+	}
+	r.tags = make([]string, len(args))
+	r.vals = make([]string, len(args))
+	// The first parameter name defaults to route
+	// 第一个参数名称默认为route
+	r.tags[0] = ParamRoute
+	r.vals[0] = args[0]
+	for i, str := range args[1:] {
+		r.tags[i+1], r.vals[i+1] = split2byte(str, '=')
+	}
+}
+
+// Give the current Node tag to Params
+//
+// The node with guards only gives the route and redirect tags, the tags of the chosen handler are set when the request is handled.
+//
+// 将当前Node的tags给予Params
+//
+// 带有约束处理者的Node只给予route和redirect标签，处理请求时设置选择的处理者的标签。
+func (r *routeData) AddTagsToParams(p Params) {
+	if len(r.guards) != 0 {
+		p.AddParam(r.tags[0], r.vals[0])
+		if redirect := getTagValue(r.tags, r.vals, ParamRedirect); len(redirect) != 0 {
+			p.AddParam(ParamRedirect, redirect)
+		}
+	} else {
+		for i := range r.tags {
+			p.AddParam(r.tags[i], r.vals[i])
+		}
+	}
+	if len(r.produces) != 0 {
+		p.AddParam(ParamProduces, r.produces)
+	}
+}
+
+// Combine the handler and the guards of the node with the middlewares matched by the route.
+//
+// If the node has guards, the handlers choose the guard by the request, and use the fallback handler or notfound if no guard matches.
+//
+// 使用路由匹配的中间件组合节点的处理者和约束处理者。
+//
+// 如果节点有约束处理者，按照请求选择约束处理者，没有约束处理者匹配时使用默认处理者或notfound。
+func (r *routeData) combine(method string, middtree *middTree, notfound, notacceptable Handler) {
+	var fallback Handler
+	if r.handler != nil {
+		hs := middtree.lookup(method, r.vals[0], getTagValue(r.tags, r.vals, ParamSkip))
+		fallback = CombineHandler(r.handler, hs)
+		r.mnum = len(hs)
+	}
+	if len(r.guards) != 0 {
+		r.guards = combineRouteGuards(r.guards, method, middtree)
+		if fallback != nil {
+			fallback = newHandlerTags(fallback, r.tags[1:], r.vals[1:])
+		}
+	}
+	r.produces = getGuardProduces(r.guards)
+	r.handlers = newHandlerGuards(r.guards, fallback, notfound, notacceptable)
+}
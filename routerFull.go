@@ -5,10 +5,15 @@ package erouter
 */
 
 import (
+	"encoding/base64"
+	"math"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -17,7 +22,6 @@ const (
 	fullNodeKindParam                      // 参数
 	fullNodeKindValid                      // 通配符正则或函数校验
 	fullNodeKindWildcard                   // 通配符
-	fullNodeKindAnyMethod
 )
 
 type (
@@ -33,6 +37,10 @@ type (
 	//
 	// 通过指定字符串构造出一个新的校验函数。
 	RouterNewCheckFunc func(string) RouterCheckFunc
+	// RouterFindFunc Route data find function, returns the submatches of a string parameter, nil if not matched.
+	//
+	// RouterFindFunc路由数据查找函数，返回一个字符串参数的子匹配，未匹配返回空。
+	RouterFindFunc func(string) []string
 	// RouterFull is implemented based on the radix tree to implement all router related features.
 	//
 	// Based on the RouterRadix extension, RouterFull implements variable check matching and wildcard check matching.
@@ -42,21 +50,50 @@ type (
 	// RouterFull基于RouterRadix扩展，实现变量校验匹配、通配符校验匹配功能。
 	RouterFull struct {
 		RouterMethod
-		// save middleware
-		// 保存注册的中间件信息
-		middtree    *middNode
-		node404     fullNode
+		// The methods registered by Any, default is a copy of RouterAllMethod.
+		//
+		// Any注册的方法集合，默认为RouterAllMethod的复制。
+		AnyMethods []string
+		// If enabled, OPTIONS requests for registered paths are answered automatically.
+		//
+		// 开启后自动响应已注册路径的OPTIONS请求，显式注册的Options处理优先。
+		AutoOptions bool
+		// If enabled, HEAD requests without a HEAD route are handled by the GET route and the body is discarded.
+		//
+		// 开启后HEAD请求未匹配时使用GET路由处理，响应body会被丢弃。
+		ImplicitHead bool
+		// If enabled, when the path is not matched, redirect to the path that toggled the trailing slash.
+		//
+		// 开启后路径未匹配时重定向到切换末尾'/'的路径，可以使用redirect标签给Group单独设置。
+		RedirectTrailingSlash bool
+		// If enabled, when the path is not matched, redirect to the cleaned path.
+		//
+		// 开启后路径未匹配时重定向到清理后的路径，可以使用redirect标签给Group单独设置。
+		RedirectFixedPath bool
+		// If enabled, when the path is not matched, redirect to the path that uses the case of the registered constants.
+		//
+		// 开启后路径未匹配时重定向到常量使用注册大小写的路径，参数值保持请求的大小写，可以使用redirect标签给Group单独设置。
+		RedirectFixedCase bool
+		// If enabled, the constants are matched case-insensitively and the param values are kept as sent, it must be set before registering routes.
+		//
+		// 开启后常量忽略大小写匹配，参数值保持请求的大小写，需要在注册路由前设置。
+		CaseInsensitive bool
+		// If enabled, registration modifies a copy of the routing data and replaces it atomically, routes can be registered while serving.
+		//
+		// 开启后注册时修改路由数据的副本，然后使用原子操作替换，可以在处理请求时注册路由。
+		CopyOnWrite bool
+		// If enabled, duplicate routes, routes shadowed by other routes and parameter name clashes fail to register.
+		//
+		// 开启后注册重复路由、被其他路由遮蔽的路由和参数名称冲突时返回错误，信息包含两次注册的文件和行号。
+		Strict      bool
 		nodefunc404 Handler
-		node405     fullNode
 		nodefunc405 Handler
-		root        fullNode
-		get         fullNode
-		post        fullNode
-		put         fullNode
-		delete      fullNode
-		options     fullNode
-		head        fullNode
-		patch       fullNode
+		nodefunc406 Handler
+		// routing data and registration errors
+		// 路由数据和注册失败的错误
+		routerStore
+		// 路由器的校验函数，继承全局校验函数
+		checks *checkRegistry
 	}
 	fullNode struct {
 		path string
@@ -69,38 +106,62 @@ type (
 		Pchildren []*fullNode
 		Vchildren []*fullNode
 		Wchildren *fullNode
-		// 默认标签的名称和值
-		tags []string
-		vals []string
 		// 校验函数
 		check RouterCheckFunc
-		// 正则捕获名称和函数
-		// names		[]string
-		// find		RouterFindFunc
-		// 路由匹配的处理者
-		handlers Handler
+		// 正则捕获名称和函数，正则带有命名捕获组时使用find匹配
+		names []string
+		find  RouterFindFunc
+		// 路由数据
+		routeData
+	}
+	// The registry of check functions, the functions not found are looked up from the parent, reads and writes are guarded by the lock.
+	//
+	// 校验函数的注册表，未找到的函数从父注册表查找，读写使用锁保护。
+	checkRegistry struct {
+		// 保存函数时增加的版本，缓存在注册表和父注册表的版本改变后失效
+		version  uint64
+		mu       sync.RWMutex
+		parent   *checkRegistry
+		funcs    map[string]RouterCheckFunc
+		newfuncs map[string]RouterNewCheckFunc
+		// 创建的动态校验函数，例如min:100，cacheVersion为创建时的版本
+		cache        map[string]RouterCheckFunc
+		cacheVersion uint64
 	}
 )
 
 // NewRouterFull 创建一个Full路由器，基于基数数实现，使用Radix路由器扩展，新增参数校验功能。
 func NewRouterFull() Router {
 	router := &RouterFull{
-		middtree:    &middNode{},
+		AnyMethods:  append([]string{}, RouterAllMethod...),
 		nodefunc404: defaultRouter404Func,
 		nodefunc405: defaultRouter405Func,
-		node404: fullNode{
+		nodefunc406: defaultRouter406Func,
+		checks:      newCheckRegistry(globalRouterChecks),
+	}
+	trees := &routerTrees{
+		middtree: &middTree{},
+		names:    make(map[string]string),
+		node404: routeData{
 			tags:     []string{ParamRoute},
 			vals:     []string{"404"},
 			handlers: defaultRouter404Func,
 		},
-		node405: fullNode{
-			Wchildren: &fullNode{
-				tags:     []string{ParamRoute},
-				vals:     []string{"405"},
-				handlers: defaultRouter405Func,
-			},
+		node405: routeData{
+			tags:     []string{ParamRoute},
+			vals:     []string{"405"},
+			handlers: defaultRouter405Func,
+		},
+		node406: routeData{
+			tags:     []string{ParamRoute},
+			vals:     []string{"406"},
+			handlers: defaultRouter406Func,
 		},
 	}
+	for _, method := range RouterAllMethod {
+		trees.newTree(method, &fullNode{})
+	}
+	router.trees.Store(trees)
 	router.RouterMethod = &RouterMethodStd{
 		RouterCore: router,
 	}
@@ -111,30 +172,49 @@ func NewRouterFull() Router {
 //
 // If the method is not empty, the path is empty and the modified path is '/'.
 //
+// The path is a scope using the same grammar as the route, matching routes on segment boundaries.
+//
 // RegisterMiddleware注册中间件到中间件树中，如果存在则追加处理者。
 //
 // 如果方法非空，路径为空，修改路径为'/'。
-func (r *RouterFull) RegisterMiddleware(method, path string, hs []Middleware) {
-	// 移除路径中的参数
-	if pos := strings.IndexByte(path, ' '); pos != -1 {
-		path = path[:pos]
-	}
+//
+// 路径是和路由语法相同的作用域，按照路径段边界匹配路由。
+func (r *RouterFull) RegisterMiddleware(method, path string, hs []Middleware) error {
+	// 分离路径中的参数，mwname参数为中间件的名称
+	args := splitRouteArgs(path)
+	path = args[0]
 	if len(method) != 0 && len(path) == 0 {
 		path = "/"
 	}
-	if method == MethodAny {
-		if path == "/" {
-			r.middtree.Insert("", hs)
-			r.node404.handlers = CombineHandler(r.nodefunc404, r.middtree.val)
-			r.node405.Wchildren.handlers = CombineHandler(r.nodefunc405, r.middtree.val)
-			return
-		}
-		for _, method = range RouterAllMethod {
-			r.middtree.Insert(method+path, hs)
-		}
-	} else {
-		r.middtree.Insert(method+path, hs)
+	trees := r.lockTrees(r.CopyOnWrite)
+	defer r.unlockTrees(trees)
+	trees.middtree.Insert(method, path, getRouteTag(args, ParamMwname), hs)
+	trees.node404.handlers = CombineHandler(r.nodefunc404, trees.middtree.val)
+	trees.node405.handlers = CombineHandler(r.nodefunc405, trees.middtree.val)
+	trees.node406.handlers = CombineHandler(r.nodefunc406, trees.middtree.val)
+	r.combineHandlers(trees)
+	return nil
+}
+
+// RemoveMiddleware Remove the middlewares named name from the scope of the method and path, and combine the handlers of the routes again.
+//
+// If name is empty, remove all middlewares of the scope; the name of the middleware is set by the mwname tag, such as "/ mwname=logger".
+//
+// RemoveMiddleware从方法和路径的作用域删除名称为name的中间件，然后重新组合路由的处理者。
+//
+// 如果name为空删除作用域的全部中间件；中间件的名称使用mwname标签设置，例如"/ mwname=logger"。
+func (r *RouterFull) RemoveMiddleware(method, path, name string) {
+	path = splitRouteArgs(path)[0]
+	if len(method) != 0 && len(path) == 0 {
+		path = "/"
 	}
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	trees.middtree.Remove(method, path, name)
+	trees.node404.handlers = CombineHandler(r.nodefunc404, trees.middtree.val)
+	trees.node405.handlers = CombineHandler(r.nodefunc405, trees.middtree.val)
+	trees.node406.handlers = CombineHandler(r.nodefunc406, trees.middtree.val)
+	r.combineHandlers(trees)
 }
 
 // RegisterHandler Register a new method request path to the router
@@ -144,51 +224,200 @@ func (r *RouterFull) RegisterMiddleware(method, path string, hs []Middleware) {
 // RegisterHandler给路由器注册一个新的方法请求路径
 //
 // 路由器会从中间件树中匹配当前路径可使用的处理者，并添加到处理者前方。
-func (r *RouterFull) RegisterHandler(method string, path string, handler Handler) {
+func (r *RouterFull) RegisterHandler(method string, path string, handler Handler) error {
+	trees := r.lockTrees(r.CopyOnWrite)
+	defer r.unlockTrees(trees)
+	var err *RouteError
 	switch method {
 	case "NotFound", "404":
 		r.nodefunc404 = handler
-		r.node404.handlers = CombineHandler(handler, r.middtree.val)
+		trees.node404.handlers = CombineHandler(handler, trees.middtree.val)
 	case "MethodNotAllowed", "405":
 		r.nodefunc405 = handler
-		r.node405.Wchildren.handlers = CombineHandler(handler, r.middtree.val)
+		trees.node405.handlers = CombineHandler(handler, trees.middtree.val)
+	case "NotAcceptable", "406":
+		r.nodefunc406 = handler
+		trees.node406.handlers = CombineHandler(handler, trees.middtree.val)
 	case MethodAny:
-		for _, method := range RouterAllMethod {
-			r.insertRoute(method, path, true, CombineHandler(handler, r.middtree.Lookup(method+path)))
-		}
+		err = r.insertRoute(trees, r.AnyMethods, path, true, handler)
 	default:
-		r.insertRoute(method, path, false, CombineHandler(handler, r.middtree.Lookup(method+path)))
+		err = r.insertRoute(trees, []string{method}, path, false, handler)
 	}
+	return r.addError(err)
 }
 
 // Add a new route Node.
 //
-// If the method does not support it will not be added, request to change the path will respond 405
+// The route is added to each method, all the methods are checked before inserting, a registration that returns an error does not modify the routes.
+// If the method tree does not exist, it is created on demand; a method that is not a valid token returns an error.
+//
+// The route with optional params is added to each path, the default values are added to the tags of the path and must pass the check functions.
+//
+// The route with header, query or cookie constraint tags is added as a guard of the Node, the route without constraints is the fallback.
 //
 // 添加一个新的路由Node。
 //
-// 如果方法不支持则不会添加，请求改路径会响应405
-func (r *RouterFull) insertRoute(method, key string, isany bool, val Handler) {
-	var currentNode *fullNode = r.getTree(method)
-	if currentNode == &r.node405 {
-		return
+// 路由添加到每个方法，插入前检查全部方法，返回错误的注册不会修改路由。
+// 如果方法树不存在会按需创建，方法不是有效的token返回错误。
+//
+// 带有可选参数的路由会添加到每个路径，默认值添加到路径的标签并且需要通过校验函数。
+//
+// 带有header、query或cookie约束标签的路由添加为Node的约束处理者，没有约束的路由为默认处理者。
+func (r *RouterFull) insertRoute(trees *routerTrees, methods []string, key string, isany bool, handler Handler) *RouteError {
+	if len(methods) == 0 {
+		return nil
 	}
+	pattern, err := parsePattern(key)
+	if err != nil {
+		err.Method = methods[0]
+		return err
+	}
+	if r.CaseInsensitive {
+		pattern.lowerConst()
+	}
+	args := pattern.args()
 
-	// 创建节点
-	args := strings.Split(key, " ")
-	for _, path := range getSplitPath(args[0]) {
-		currentNode = currentNode.InsertNode(path, newFullNode(path))
+	// 先创建全部Node检查校验函数和默认值
+	for _, seg := range pattern.Segments {
+		node := newFullNode(seg.Path, r.checks)
+		if node.kind&(fullNodeKindRegex|fullNodeKindValid) != 0 && node.check == nil {
+			return newRouteError(methods[0], args[0], seg.Pos, "check function of '"+seg.Path+"' is undefined or invalid")
+		}
+		if node.check != nil && len(seg.Default) != 0 && !node.check(seg.Default) {
+			return newRouteError(methods[0], args[0], seg.Pos, "default value of '"+seg.Path+"' check failed")
+		}
+	}
+	var source string
+	if r.Strict {
+		source = getCallerSource()
+	}
+	constraints := getRouteConstraints(args)
+	// 先检查全部方法，注册失败时不修改路由
+	for _, method := range methods {
+		tree, _ := trees.getTree(method).(*fullNode)
+		if tree == nil && !isMethodToken(method) {
+			return newRouteError(method, args[0], -1, "method is not a valid token")
+		}
+		if r.Strict && tree != nil {
+			if err := r.checkRoute(tree, method, pattern, args, constraints, isany, source); err != nil {
+				return err
+			}
+		}
+	}
+	name := getRouteName(args)
+	if pattern, ok := trees.names[name]; r.Strict && ok && pattern != args[0] {
+		return newRouteError(methods[0], args[0], -1, newStrictName(source, name, pattern))
 	}
+	for _, method := range methods {
+		r.insertPattern(trees, method, pattern, args, constraints, isany, handler, source)
+	}
+	if len(name) != 0 {
+		trees.names[name] = args[0]
+	}
+	trees.redirect |= getRedirectPolicy(getRouteTag(args, ParamRedirect), false, false, false)
+	return nil
+}
 
-	if isany {
-		if currentNode.kind&fullNodeKindAnyMethod != fullNodeKindAnyMethod && currentNode.handlers != nil {
-			return
+// Check the route in strict mode before any node is inserted, a param that clashes or a route that is registered repeatedly returns an error.
+//
+// 严格模式下在插入节点前检查路由，参数冲突或路由重复注册返回错误。
+func (r *RouterFull) checkRoute(tree *fullNode, method string, pattern *Pattern, args []string, constraints []routeConstraint, isany bool, source string) *RouteError {
+	for _, optional := range pattern.expand() {
+		var currentNode = tree
+		for _, seg := range optional.segments {
+			nextNode := newFullNode(seg.Path, r.checks)
+			if node := currentNode.getConflictNode(nextNode); node != nil {
+				return newRouteError(method, args[0], seg.Pos, newStrictConflict(source, seg.Path, node.path, node.source))
+			}
+			if currentNode = currentNode.lookupNode(seg.Path, nextNode); currentNode == nil {
+				break
+			}
+		}
+		switch {
+		case currentNode == nil:
+		case len(constraints) != 0:
+			if guard := getRouteGuard(currentNode.guards, constraints); guard != nil {
+				return newRouteError(method, args[0], -1, newStrictDuplicate(source, isany, guard.isany, guard.vals[0], guard.source))
+			}
+		case currentNode.handler != nil:
+			return newRouteError(method, args[0], -1, newStrictDuplicate(source, isany, currentNode.isany, currentNode.vals[0], currentNode.source))
 		}
-		currentNode.kind |= fullNodeKindAnyMethod
 	}
+	return nil
+}
 
-	currentNode.handlers = val
-	currentNode.SetTags(args)
+// Insert the paths of the pattern to the method tree, the route has been checked.
+//
+// 将路由模式的路径插入方法树，路由已经检查。
+func (r *RouterFull) insertPattern(trees *routerTrees, method string, pattern *Pattern, args []string, constraints []routeConstraint, isany bool, handler Handler, source string) {
+	tree, _ := trees.getTree(method).(*fullNode)
+	if tree == nil {
+		tree = &fullNode{}
+		trees.newTree(method, tree)
+	}
+	for _, optional := range pattern.expand() {
+		// 创建节点
+		var currentNode = tree
+		for _, seg := range optional.segments {
+			nextNode := newFullNode(seg.Path, r.checks)
+			currentNode = currentNode.InsertNode(seg.Path, nextNode)
+			if currentNode == nextNode {
+				currentNode.source = source
+			}
+		}
+
+		tags := append(args[:len(args):len(args)], optional.defaults...)
+		if len(constraints) != 0 {
+			guard := getRouteGuard(currentNode.guards, constraints)
+			if isany && guard != nil && !guard.isany {
+				continue
+			}
+			currentNode.guards = insertRouteGuard(currentNode.guards, newRouteGuard(tags, constraints, isany, handler, source))
+			if currentNode.tags == nil {
+				currentNode.SetTags(append([]string{args[0]}, optional.defaults...))
+			}
+			currentNode.combine(method, trees.middtree, r.handle404, r.handle406)
+			continue
+		}
+
+		if isany {
+			if !currentNode.isany && currentNode.handler != nil {
+				continue
+			}
+			currentNode.isany = true
+		}
+
+		currentNode.handler = handler
+		currentNode.source = source
+		currentNode.SetTags(tags)
+		currentNode.combine(method, trees.middtree, r.handle404, r.handle406)
+	}
+}
+
+// RemoveHandler Remove a route from the router, the empty nodes are pruned and the nodes are merged.
+//
+// The routing data is copied and modified, then replaced atomically, ANY method only removes the routes registered by Any.
+//
+// RemoveHandler从路由器删除一个路由，会裁剪空节点并合并节点。
+//
+// 路由数据会复制后修改，然后使用原子操作替换，ANY方法只删除Any注册的路由。
+func (r *RouterFull) RemoveHandler(method string, path string) {
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	r.modifyRoutes(trees, r.AnyMethods, method, path, r.CaseInsensitive, nil)
+}
+
+// ReplaceHandler Replace the handler of a registered route, in-flight requests use the old or new handler.
+//
+// The router matches the handlers available to the current path from the middleware tree and adds them to the front of the handler.
+//
+// ReplaceHandler替换一个已注册路由的处理者，正在处理的请求使用旧的或新的处理者。
+//
+// 路由器会从中间件树中匹配当前路径可使用的处理者，并添加到处理者前方。
+func (r *RouterFull) ReplaceHandler(method string, path string, handler Handler) {
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	r.modifyRoutes(trees, r.AnyMethods, method, path, r.CaseInsensitive, handler)
 }
 
 // 实现http.Handler接口，进行路由匹配并处理http请求。
@@ -200,36 +429,32 @@ func (r *RouterFull) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	paramArrayPool.Put(p)
 }
 
-// Match a request, if the method does not allow direct return to node405, no match returns node404.
+// Match a request, if the path matches other methods return node405, no match returns node404.
 //
-// 匹配一个请求，如果方法不不允许直接返回node405，未匹配返回node404。
-func (r *RouterFull) Match(method, path string, params Params) Handler {
-	if n := r.getTree(method).recursiveLoopup(path, params); n != nil {
-		return n
-	}
-
-	// 处理404
-	r.node404.AddTagsToParams(params)
-	return r.node404.handlers
-}
-
-// Create a 405 response radixNode.
+// The routing data is loaded atomically once, registration does not affect the matching request.
 //
-// 创建一个405响应的radixNode。
-func newFullNode405(args string, h Handler) *fullNode {
-	newNode := &fullNode{
-		Wchildren: &fullNode{
-			handlers: h,
-		},
-	}
-	newNode.Wchildren.SetTags(strings.Split(args, " "))
-	return newNode
+// 匹配一个请求，如果路径可以匹配其他方法返回node405，未匹配返回node404。
+//
+// 路由数据使用原子操作加载一次，注册不会影响正在匹配的请求。
+//
+// 返回405时会将路径允许的方法使用allow参数保存，如果开启ImplicitHead和AutoOptions，HEAD和OPTIONS请求返回自动处理。
+//
+// 如果切换末尾'/'或清理后的路径可以匹配，并且路由的重定向策略允许，返回重定向处理。
+func (r *RouterFull) Match(method, path string, params Params) Handler {
+	return r.trees.Load().(*routerTrees).match(method, path, params, routerOptions{
+		fold:    r.CaseInsensitive,
+		head:    r.ImplicitHead,
+		options: r.AutoOptions,
+		slash:   r.RedirectTrailingSlash,
+		fixed:   r.RedirectFixedPath,
+		cased:   r.RedirectFixedCase,
+	})
 }
 
 // 创建一个Radix树Node，会根据当前路由设置不同的节点类型和名称。
 //
 // '*'前缀为通配符节点，':'前缀为参数节点，其他未常量节点,如果通配符和参数结点后带有符号'|'则为校验结点。
-func newFullNode(path string) *fullNode {
+func newFullNode(path string, checks *checkRegistry) *fullNode {
 	newNode := &fullNode{path: path}
 	switch path[0] {
 	case '*':
@@ -240,12 +465,10 @@ func newFullNode(path string) *fullNode {
 			newNode.name = path[1:]
 			// 如果路径后序具有'|'符号，则截取后端名称返回校验函数
 			// 并升级成校验通配符Node
-			if name, fn := loadCheckFunc(path); len(name) > 0 {
-				// 无法获得校验函数抛出错误
-				if fn == nil {
-					panic("loadCheckFunc path is invalid, load func failure " + path)
-				}
+			// 无法获得校验函数时check为空，注册时返回错误
+			if name, fn := checks.loadCheckFunc(path); len(name) > 0 {
 				newNode.kind, newNode.name, newNode.check = fullNodeKindValid, name, fn
+				newNode.names, newNode.find = loadFindFunc(path)
 			}
 		}
 	case ':':
@@ -253,11 +476,9 @@ func newFullNode(path string) *fullNode {
 		newNode.name = path[1:]
 		// 如果路径后序具有'|'符号，则截取后端名称返回校验函数
 		// 并升级成校验参数Node
-		if name, fn := loadCheckFunc(path); len(name) > 0 {
-			if fn == nil {
-				panic("loadCheckFunc path is invalid, load func failure " + path)
-			}
+		if name, fn := checks.loadCheckFunc(path); len(name) > 0 {
 			newNode.kind, newNode.name, newNode.check = fullNodeKindRegex, name, fn
+			newNode.names, newNode.find = loadFindFunc(path)
 		}
 	// 常量Node
 	default:
@@ -268,8 +489,15 @@ func newFullNode(path string) *fullNode {
 
 // Load the checksum function by name.
 //
+// The check functions are chained by '|' and every link must pass, '||' separates the alternative chains,
+// the '!' prefix negates a link, and the regular expression runs to the end of the chain.
+//
 // 根据名称加载校验函数。
-func loadCheckFunc(path string) (string, RouterCheckFunc) {
+//
+// 校验函数使用'|'连接并且需要全部通过，'||'分隔可选的校验链，'!'前缀取反一个校验，正则表达式延续到校验链结尾。
+//
+// 例如:id|isnum|min:1|max:1000、:name|!in:admin,root、:id|uuid||isnum|min:1。
+func (c *checkRegistry) loadCheckFunc(path string) (string, RouterCheckFunc) {
 	// invalid path
 	// 无效路径
 	if len(path) == 0 || (path[0] != ':' && path[0] != '*') {
@@ -283,6 +511,56 @@ func loadCheckFunc(path string) (string, RouterCheckFunc) {
 		return "", nil
 	}
 
+	var chains [][]RouterCheckFunc
+	var links []RouterCheckFunc
+	for {
+		// 正则表达式延续到结尾，其他校验在'|'处结束
+		link, next, last := fname, "", true
+		if pos := strings.IndexByte(fname, '|'); pos != -1 && fname[0] != '^' && !strings.HasPrefix(fname, "!^") {
+			link, next, last = fname[:pos], fname[pos+1:], false
+		}
+		fname = next
+		// "||"之间的空校验分隔可选的校验链
+		if len(link) == 0 {
+			if last || len(links) == 0 {
+				return name, nil
+			}
+			chains = append(chains, links)
+			links = nil
+			continue
+		}
+		fn := c.loadCheckLink(link)
+		if fn == nil {
+			return name, nil
+		}
+		links = append(links, fn)
+		if last {
+			break
+		}
+	}
+	if len(chains) == 0 && len(links) == 1 {
+		return name, links[0]
+	}
+	return name, newCheckChain(append(chains, links))
+}
+
+// Load a link of the check chain, the '!' prefix negates the check.
+//
+// 加载校验链的一环，'!'前缀取反校验。
+func (c *checkRegistry) loadCheckLink(fname string) RouterCheckFunc {
+	if len(fname) == 0 {
+		return nil
+	}
+	if fname[0] == '!' {
+		fn := c.loadCheckLink(fname[1:])
+		if fn == nil {
+			return nil
+		}
+		return func(arg string) bool {
+			return !fn(arg)
+		}
+	}
+
 	// regular
 	// If it is the beginning of a regular expression, add the default regular check function name.
 	// 正则
@@ -297,16 +575,182 @@ func loadCheckFunc(path string) (string, RouterCheckFunc) {
 	// no ':' is a fixed function, return directly
 	// 没有':'为固定函数，直接返回
 	if len(arg) == 0 {
-		return name, GetRouterCheckFunc(fname)
+		return c.getCheckFunc(fname)
 	}
 
 	// There is a ':' variable function to create a checksum function
 	// 有':'为变量函数，创建校验函数
-	fn := GetRouterNewCheckFunc(f2name)(arg)
+	version := c.getVersion()
+	c.mu.RLock()
+	fn := c.cache[fname]
+	if c.cacheVersion != version {
+		fn = nil
+	}
+	c.mu.RUnlock()
+	if fn != nil {
+		return fn
+	}
+	newfn := c.getNewCheckFunc(f2name)
+	if newfn == nil {
+		return nil
+	}
+	fn = newfn(arg)
 	// save the newly created checksum function
 	// 保存新建的校验函数
-	SetRouterCheckFunc(fname, fn)
-	return name, fn
+	if fn != nil {
+		c.mu.Lock()
+		if c.cacheVersion != version {
+			c.cache = make(map[string]RouterCheckFunc)
+			c.cacheVersion = version
+		}
+		c.cache[fname] = fn
+		c.mu.Unlock()
+	}
+	return fn
+}
+
+// Create a registry of check functions, parent is the registry to inherit.
+//
+// 创建一个校验函数注册表，parent为继承的注册表。
+func newCheckRegistry(parent *checkRegistry) *checkRegistry {
+	return &checkRegistry{
+		parent:   parent,
+		funcs:    make(map[string]RouterCheckFunc),
+		newfuncs: make(map[string]RouterNewCheckFunc),
+		cache:    make(map[string]RouterCheckFunc),
+	}
+}
+
+// Save a check function, the created dynamic check functions of the registry and its children are invalidated.
+//
+// 保存一个校验函数，注册表和子注册表已创建的动态校验函数失效。
+func (c *checkRegistry) setCheckFunc(name string, fn RouterCheckFunc) {
+	c.mu.Lock()
+	c.funcs[name] = fn
+	atomic.AddUint64(&c.version, 1)
+	c.mu.Unlock()
+}
+
+// Get a check function, if not found, look up from the parent.
+//
+// 获得一个校验函数，未找到时从父注册表查找。
+func (c *checkRegistry) getCheckFunc(name string) RouterCheckFunc {
+	for ; c != nil; c = c.parent {
+		c.mu.RLock()
+		fn := c.funcs[name]
+		c.mu.RUnlock()
+		if fn != nil {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Save a dynamic check function creator, the created dynamic check functions of the registry and its children are invalidated.
+//
+// 保存一个动态校验函数的创建函数，注册表和子注册表已创建的动态校验函数失效。
+func (c *checkRegistry) setNewCheckFunc(name string, fn RouterNewCheckFunc) {
+	c.mu.Lock()
+	c.newfuncs[name] = fn
+	atomic.AddUint64(&c.version, 1)
+	c.mu.Unlock()
+}
+
+// Get the sum of the versions of the registry and its parents, the sum changes after any of them saves a function.
+//
+// 获取注册表和父注册表的版本之和，任一注册表保存函数后改变。
+func (c *checkRegistry) getVersion() uint64 {
+	var version uint64
+	for ; c != nil; c = c.parent {
+		version += atomic.LoadUint64(&c.version)
+	}
+	return version
+}
+
+// Get a dynamic check function creator, if not found, look up from the parent.
+//
+// 获得一个动态校验函数的创建函数，未找到时从父注册表查找。
+func (c *checkRegistry) getNewCheckFunc(name string) RouterNewCheckFunc {
+	for ; c != nil; c = c.parent {
+		c.mu.RLock()
+		fn := c.newfuncs[name]
+		c.mu.RUnlock()
+		if fn != nil {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Create the check function of the alternative chains, one of the chains passes if all its links pass.
+//
+// 创建可选校验链的校验函数，一个校验链的全部校验通过即通过。
+func newCheckChain(chains [][]RouterCheckFunc) RouterCheckFunc {
+	return func(arg string) bool {
+		for _, links := range chains {
+			pass := true
+			for _, fn := range links {
+				if !fn(arg) {
+					pass = false
+					break
+				}
+			}
+			if pass {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Load the find function of the regular expression with named capture groups, return the capture names and the find function.
+//
+// The regular expression is the last link of the check chain, without named capture groups returns nil, and only uses the check function.
+//
+// 加载带有命名捕获组的正则表达式的查找函数，返回捕获名称和查找函数。
+//
+// 正则表达式为校验链的最后一环，没有命名捕获组返回空，仅使用校验函数。
+func loadFindFunc(path string) ([]string, RouterFindFunc) {
+	_, fname := split2byte(path, '|')
+	for len(fname) != 0 && fname[0] != '^' {
+		pos := strings.IndexByte(fname, '|')
+		if pos == -1 || strings.HasPrefix(fname, "!^") {
+			return nil, nil
+		}
+		fname = fname[pos+1:]
+	}
+	if len(fname) == 0 {
+		return nil, nil
+	}
+	re, err := regexp.Compile(fname)
+	if err != nil {
+		return nil, nil
+	}
+	names := re.SubexpNames()
+	for _, name := range names {
+		if len(name) != 0 {
+			return names, re.FindStringSubmatch
+		}
+	}
+	return nil, nil
+}
+
+// Add the named capture groups of the matched key to params, the groups are not added if the regular expression is not matched in alternation.
+//
+// 将匹配值的命名捕获组添加到params，在选择校验中正则未匹配时不添加。
+func (r *fullNode) addCapturesToParams(p Params, key string) {
+	if r.find == nil {
+		return
+	}
+	vals := r.find(key)
+	if vals == nil {
+		return
+	}
+	for i, name := range r.names {
+		if len(name) != 0 {
+			p.AddParam(name, vals[i])
+		}
+	}
 }
 
 // Add a child node to the node.
@@ -329,7 +773,7 @@ func (r *fullNode) InsertNode(path string, nextNode *fullNode) *fullNode {
 
 				newNode := r.SplitNode(subStr, r.Cchildren[i].path)
 				if newNode == nil {
-					panic("Unexpect error on split node")
+					return nil
 				}
 				return newNode.InsertNode(strings.TrimPrefix(path, subStr), nextNode)
 			}
@@ -376,13 +820,88 @@ func (r *fullNode) InsertNode(path string, nextNode *fullNode) *fullNode {
 	case fullNodeKindWildcard:
 		// Set the wildcard Node data.
 		// 设置通配符Node数据。
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return r.Wchildren
+		}
 		r.Wchildren = nextNode
 	default:
-		panic("Undefined radix node type from router full.")
+		// Undefined radix node type from router full.
+		return nil
 	}
 	return nextNode
 }
 
+// Get the Node that InsertNode returns for the path without modifying the tree, return nil if a new Node would be created.
+//
+// 获取InsertNode对路径返回的Node但不修改树，如果会创建新Node返回nil。
+func (r *fullNode) lookupNode(path string, nextNode *fullNode) *fullNode {
+	if len(path) == 0 {
+		return r
+	}
+	var nodes []*fullNode
+	switch nextNode.kind {
+	case fullNodeKindConst:
+		for _, i := range r.Cchildren {
+			if strings.HasPrefix(path, i.path) {
+				return i.lookupNode(path[len(i.path):], nextNode)
+			}
+		}
+	case fullNodeKindParam:
+		nodes = r.Pchildren
+	case fullNodeKindRegex:
+		nodes = r.Rchildren
+	case fullNodeKindValid:
+		nodes = r.Vchildren
+	case fullNodeKindWildcard:
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return r.Wchildren
+		}
+	}
+	for _, i := range nodes {
+		if i.path == path {
+			return i
+		}
+	}
+	return nil
+}
+
+// Get the child Node that conflicts with nextNode.
+//
+// A param or wildcard Node with a different name at the same position conflicts, check Nodes conflict only if the check functions are the same.
+//
+// 获取和nextNode冲突的子Node。
+//
+// 相同位置名称不同的参数或通配符Node冲突，校验Node仅在校验函数相同时冲突。
+func (r *fullNode) getConflictNode(nextNode *fullNode) *fullNode {
+	var nodes []*fullNode
+	switch nextNode.kind {
+	case fullNodeKindParam:
+		nodes = r.Pchildren
+	case fullNodeKindRegex:
+		nodes = r.Rchildren
+	case fullNodeKindValid:
+		nodes = r.Vchildren
+	case fullNodeKindWildcard:
+		if r.Wchildren != nil && r.Wchildren.path != nextNode.path {
+			return r.Wchildren
+		}
+		return nil
+	default:
+		return nil
+	}
+	_, check := split2byte(nextNode.path, '|')
+	var conflict *fullNode
+	for _, i := range nodes {
+		if i.path == nextNode.path {
+			return nil
+		}
+		if _, fname := split2byte(i.path, '|'); fname == check && conflict == nil {
+			conflict = i
+		}
+	}
+	return conflict
+}
+
 // Bifurcate the child node whose path is edgeKey, and the fork common prefix path is pathKey
 //
 // 对指定路径为edgeKey的子节点分叉，分叉公共前缀路径为pathKey
@@ -400,59 +919,159 @@ func (r *fullNode) SplitNode(pathKey, edgeKey string) *fullNode {
 	return nil
 }
 
-// Set the tags for the current Node
+// Deep copy the Node and its child Nodes, tags, check functions and handlers are shared.
 //
-// 给当前Node设置tags
-func (r *fullNode) SetTags(args []string) {
-	if len(args) == 0 {
-		return
+// 深复制Node和子Node，tags、校验函数和处理者共享。
+func (r *fullNode) clone() *fullNode {
+	newNode := *r
+	newNode.Cchildren = cloneFullNodes(r.Cchildren)
+	newNode.Rchildren = cloneFullNodes(r.Rchildren)
+	newNode.Pchildren = cloneFullNodes(r.Pchildren)
+	newNode.Vchildren = cloneFullNodes(r.Vchildren)
+	if r.Wchildren != nil {
+		newNode.Wchildren = r.Wchildren.clone()
+	}
+	return &newNode
+}
+
+func (r *fullNode) cloneNode() routeNode {
+	return r.clone()
+}
+
+func cloneFullNodes(nodes []*fullNode) []*fullNode {
+	if nodes == nil {
+		return nil
 	}
-	r.tags = make([]string, len(args))
-	r.vals = make([]string, len(args))
-	// The first parameter name defaults to route
-	// 第一个参数名称默认为route
-	r.tags[0] = ParamRoute
-	r.vals[0] = args[0]
-	for i, str := range args[1:] {
-		r.tags[i+1], r.vals[i+1] = split2byte(str, '=')
+	newNodes := make([]*fullNode, len(nodes))
+	for i := range nodes {
+		newNodes[i] = nodes[i].clone()
 	}
+	return newNodes
 }
 
-// Give the current Node tag to Params
+// Find the child Node whose path is path, append the passing Nodes to nodes, return nil if not found.
 //
-// 将当前Node的tags给予Params
-func (r *fullNode) AddTagsToParams(p Params) {
-	for i := range r.tags {
-		p.AddParam(r.tags[i], r.vals[i])
+// 查找路径为path的子Node，将经过的Node追加到nodes，未找到返回nil。
+func (r *fullNode) findNode(path string, nodes []routeNode) []routeNode {
+	var children []*fullNode
+	switch path[0] {
+	case ':':
+		children = append(r.Pchildren[:len(r.Pchildren):len(r.Pchildren)], r.Rchildren...)
+	case '*':
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return append(nodes, r.Wchildren)
+		}
+		children = r.Vchildren
+	default:
+		// 常量Node首字母不同，最多一个前缀匹配
+		for _, i := range r.Cchildren {
+			if strings.HasPrefix(path, i.path) {
+				if len(path) == len(i.path) {
+					return append(nodes, i)
+				}
+				return i.findNode(path[len(i.path):], append(nodes, i))
+			}
+		}
+	}
+	for _, i := range children {
+		if i.path == path {
+			return append(nodes, i)
+		}
 	}
+	return nil
 }
 
-// Get the tree of the corresponding method.
+// Check if the Node has no handler and no child Nodes.
 //
-// Support eudore.RouterAllMethod these methods, weak support will return 405 processing tree.
+// 检查Node是否没有处理者和子Node。
+func (r *fullNode) isEmpty() bool {
+	return r.handlers == nil && len(r.Cchildren) == 0 && r.pnum == 0 && len(r.Vchildren) == 0 && r.Wchildren == nil
+}
+
+// Delete a child Node.
 //
-// 获取对应方法的树。
+// 删除一个子Node。
+func (r *fullNode) deleteNode(node routeNode) {
+	n, _ := node.(*fullNode)
+	if r.Wchildren == n {
+		r.Wchildren = nil
+	}
+	r.Cchildren = deleteFullNode(r.Cchildren, n)
+	r.Vchildren = deleteFullNode(r.Vchildren, n)
+	r.Rchildren = deleteFullNode(r.Rchildren, n)
+	r.Pchildren = deleteFullNode(r.Pchildren, n)
+	r.pnum = uint8(len(r.Rchildren) + len(r.Pchildren))
+}
+
+func deleteFullNode(nodes []*fullNode, node *fullNode) []*fullNode {
+	for i := range nodes {
+		if nodes[i] == node {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+// If the constant Node has no handler and only one constant child Node, merge the child Node into the current Node.
 //
-// 支持eudore.RouterAllMethod这些方法,弱不支持会返回405处理树。
-func (r *RouterFull) getTree(method string) *fullNode {
-	switch method {
-	case MethodGet:
-		return &r.get
-	case MethodPost:
-		return &r.post
-	case MethodDelete:
-		return &r.delete
-	case MethodPut:
-		return &r.put
-	case MethodHead:
-		return &r.head
-	case MethodOptions:
-		return &r.options
-	case MethodPatch:
-		return &r.patch
-	default:
-		return &r.node405
+// 如果常量Node没有处理者并且只有一个常量子Node，将子Node合并到当前Node。
+func (r *fullNode) mergeNode() {
+	if r.kind&(fullNodeKindRegex|fullNodeKindParam|fullNodeKindValid|fullNodeKindWildcard) != 0 || r.handlers != nil || len(r.Cchildren) != 1 || r.pnum != 0 || len(r.Vchildren) != 0 || r.Wchildren != nil {
+		return
 	}
+	path := r.path + r.Cchildren[0].path
+	*r = *r.Cchildren[0]
+	r.path = path
+}
+
+// Batch registers all routes in fn on a copy of the routing data, and replaces the routing data atomically once fn returns.
+//
+// Registrations from other goroutines during the batch are also added to the batch, if fn panics the batch is discarded.
+//
+// Batch在路由数据的副本上注册fn中的全部路由，fn返回后使用一次原子操作替换路由数据。
+//
+// 批量期间其他goroutine的注册也会加入批量，如果fn发生panic，批量会被丢弃。
+func (r *RouterFull) Batch(fn func(RouterMethod)) {
+	r.batchTrees(func() {
+		fn(r.RouterMethod)
+	})
+}
+
+// SetCheckFunc Save a RouterCheckFunc of the router, the functions not set use the global functions, can be called concurrently.
+//
+// The routes registered are not affected.
+//
+// SetCheckFunc保存一个路由器的RouterCheckFunc函数，未设置的函数使用全局函数，可以并发调用。
+//
+// 已注册的路由不受影响。
+func (r *RouterFull) SetCheckFunc(name string, fn RouterCheckFunc) {
+	r.checks.setCheckFunc(name, fn)
+}
+
+// SetNewCheckFunc Save a RouterNewCheckFunc of the router, the functions not set use the global functions, can be called concurrently.
+//
+// The routes registered are not affected.
+//
+// SetNewCheckFunc保存一个路由器的RouterNewCheckFunc函数，未设置的函数使用全局函数，可以并发调用。
+//
+// 已注册的路由不受影响。
+func (r *RouterFull) SetNewCheckFunc(name string, fn RouterNewCheckFunc) {
+	r.checks.setNewCheckFunc(name, fn)
+}
+
+// URL Builds the url of the route named name, args are the parameter names and values in pairs.
+//
+// The parameter values are checked by the check functions of the route, and an error is returned if the check fails.
+//
+// URL使用名称为name的路由创建url，args为成对的参数名称和值。
+//
+// 参数值会使用路由的校验函数检查，校验失败返回错误。
+func (r *RouterFull) URL(name string, args ...string) (string, error) {
+	pattern, ok := r.trees.Load().(*routerTrees).names[name]
+	if !ok {
+		return "", routeNameError(name)
+	}
+	return newRouteURL(pattern, args, r.checks.loadCheckFunc)
 }
 
 // Recursively add a constant Node with a path of containKey to the current node
@@ -482,7 +1101,74 @@ func (r *fullNode) recursiveInsertTree(containKey string, targetNode *fullNode)
 	return r.InsertNode(containKey, targetNode)
 }
 
-func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
+// Whether the Node has constant child Nodes inside the segment, such as '.' in "/files/:name.:ext".
+//
+// Node是否有段内的常量子Node，例如"/files/:name.:ext"中的'.'。
+func (r *fullNode) hasInnerChildren() bool {
+	for _, i := range r.Cchildren {
+		if i.path[0] != '/' {
+			return true
+		}
+	}
+	return false
+}
+
+// Recursively combine the handler of the Node and its child Nodes with the middlewares matched by the route.
+//
+// 递归使用路由匹配的中间件组合Node和子Node的处理者。
+func (r *fullNode) recursiveCombine(method string, middtree *middTree, notfound, notacceptable Handler) {
+	if r.handlers != nil {
+		r.combine(method, middtree, notfound, notacceptable)
+	}
+	for _, children := range [][]*fullNode{r.Cchildren, r.Rchildren, r.Pchildren, r.Vchildren} {
+		for _, i := range children {
+			i.recursiveCombine(method, middtree, notfound, notacceptable)
+		}
+	}
+	if r.Wchildren != nil {
+		r.Wchildren.recursiveCombine(method, middtree, notfound, notacceptable)
+	}
+}
+
+// Recursively append the route information of the Node and its child Nodes, params and checks are the parameter names and check functions passed.
+//
+// 递归追加Node和子Node的路由信息，params和checks为经过的参数名称和校验函数。
+func (r *fullNode) recursiveRoutes(method string, params, checks []string, routes []RouteInfo) []RouteInfo {
+	if r.kind&(fullNodeKindRegex|fullNodeKindParam|fullNodeKindValid|fullNodeKindWildcard) != 0 {
+		_, check := split2byte(r.path, '|')
+		params = append(params[:len(params):len(params)], r.name)
+		checks = append(checks[:len(checks):len(checks)], check)
+		for _, name := range r.names {
+			if len(name) != 0 {
+				params = append(params, name)
+				checks = append(checks, "")
+			}
+		}
+	}
+	if r.handler != nil {
+		routes = append(routes, newRouteInfo(method, r.tags, r.vals, params, checks, r.isany, r.mnum))
+	}
+	routes = appendGuardRoutes(routes, r.guards, method, params, checks)
+	for _, children := range [][]*fullNode{r.Cchildren, r.Rchildren, r.Pchildren, r.Vchildren} {
+		for _, i := range children {
+			routes = i.recursiveRoutes(method, params, checks, routes)
+		}
+	}
+	if r.Wchildren != nil {
+		routes = r.Wchildren.recursiveRoutes(method, params, checks, routes)
+	}
+	return routes
+}
+
+// Get the route information of the Node and its child Nodes.
+//
+// 获取Node和子Node的路由信息。
+func (r *fullNode) getRoutes(method string, routes []RouteInfo) []RouteInfo {
+	return r.recursiveRoutes(method, nil, nil, routes)
+}
+
+// 按照顺序匹配一个路径，如果fold为true，常量Node为小写，请求路径的常量部分忽略大小写匹配，参数值保持请求的大小写。
+func (r *fullNode) recursiveLoopup(searchKey string, params Params, fold bool) Handler {
 
 	// constant match, return data
 	// 常量匹配，返回数据
@@ -494,11 +1180,16 @@ func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
 	if len(searchKey) > 0 {
 		// Traverse constant Node match
 		// 遍历常量Node匹配
+		// 忽略大小写时常量为小写，使用小写的首字母比较
+		first := searchKey[0]
+		if fold {
+			first = toLowerASCII(first)
+		}
 		for _, edgeObj := range r.Cchildren {
-			if edgeObj.path[0] >= searchKey[0] {
-				if len(searchKey) >= len(edgeObj.path) && searchKey[:len(edgeObj.path)] == edgeObj.path {
+			if edgeObj.path[0] >= first {
+				if len(searchKey) >= len(edgeObj.path) && (searchKey[:len(edgeObj.path)] == edgeObj.path || (fold && equalFoldASCII(searchKey[:len(edgeObj.path)], edgeObj.path))) {
 					nextSearchKey := searchKey[len(edgeObj.path):]
-					if n := edgeObj.recursiveLoopup(nextSearchKey, params); n != nil {
+					if n := edgeObj.recursiveLoopup(nextSearchKey, params, fold); n != nil {
 						return n
 					}
 				}
@@ -520,9 +1211,22 @@ func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
 			// check parameter matching
 			// 校验参数匹配
 			for _, edgeObj := range r.Rchildren {
+				// 校验参数后有段内常量，从最长的值开始依次尝试校验并在段内结束参数
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if edgeObj.check(searchKey[:i]) {
+							if n := edgeObj.recursiveLoopup(searchKey[i:], params, fold); n != nil {
+								params.AddParam(edgeObj.name, searchKey[:i])
+								edgeObj.addCapturesToParams(params, searchKey[:i])
+								return n
+							}
+						}
+					}
+				}
 				if edgeObj.check(currentKey) {
-					if n := edgeObj.recursiveLoopup(nextSearchKey, params); n != nil {
+					if n := edgeObj.recursiveLoopup(nextSearchKey, params, fold); n != nil {
 						params.AddParam(edgeObj.name, currentKey)
+						edgeObj.addCapturesToParams(params, currentKey)
 						return n
 					}
 				}
@@ -531,7 +1235,16 @@ func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
 			// 参数匹配
 			// 变量Node依次匹配是否满足
 			for _, edgeObj := range r.Pchildren {
-				if n := edgeObj.recursiveLoopup(nextSearchKey, params); n != nil {
+				// 参数后有段内常量，从最长的值开始依次尝试在段内结束参数
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if n := edgeObj.recursiveLoopup(searchKey[i:], params, fold); n != nil {
+							params.AddParam(edgeObj.name, searchKey[:i])
+							return n
+						}
+					}
+				}
+				if n := edgeObj.recursiveLoopup(nextSearchKey, params, fold); n != nil {
 					params.AddParam(edgeObj.name, currentKey)
 					return n
 				}
@@ -547,6 +1260,7 @@ func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
 		if edgeObj.check(searchKey) {
 			edgeObj.AddTagsToParams(params)
 			params.AddParam(edgeObj.name, searchKey)
+			edgeObj.addCapturesToParams(params, searchKey)
 			return edgeObj.handlers
 		}
 	}
@@ -564,29 +1278,113 @@ func (r *fullNode) recursiveLoopup(searchKey string, params Params) Handler {
 	return nil
 }
 
-var (
-	globalRouterCheckFunc    = make(map[string]RouterCheckFunc)
-	globalRouterNewCheckFunc = make(map[string]RouterNewCheckFunc)
-)
+// Match a path with the constant Nodes case-insensitively in the same order as recursiveLoopup,
+// the matched constants are written to buf with the registered case, the param and wildcard values are kept as sent.
+//
+// 按照和recursiveLoopup相同的顺序匹配一个路径，常量Node忽略大小写匹配，
+// 匹配的常量使用注册的大小写写入buf，参数和通配符的值保持请求的大小写。
+func (r *fullNode) recursiveCasePath(searchKey string, buf []byte) bool {
+	if len(searchKey) == 0 && r.handlers != nil {
+		return true
+	}
+
+	if len(searchKey) > 0 {
+		// 常量Node按照首字母排序，大写字母在小写字母之前
+		pos := len(buf) - len(searchKey)
+		lower := toLowerASCII(searchKey[0])
+		for _, edgeObj := range r.Cchildren {
+			if edgeObj.path[0] > lower {
+				break
+			}
+			if len(searchKey) >= len(edgeObj.path) && equalFoldASCII(searchKey[:len(edgeObj.path)], edgeObj.path) {
+				copy(buf[pos:], edgeObj.path)
+				if edgeObj.recursiveCasePath(searchKey[len(edgeObj.path):], buf) {
+					return true
+				}
+				copy(buf[pos:], searchKey[:len(edgeObj.path)])
+			}
+		}
+
+		if r.pnum != 0 {
+			pos := strings.IndexByte(searchKey, '/')
+			if pos == -1 {
+				pos = len(searchKey)
+			}
+			currentKey, nextSearchKey := searchKey[:pos], searchKey[pos:]
+			for _, edgeObj := range r.Rchildren {
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if edgeObj.check(searchKey[:i]) && edgeObj.recursiveCasePath(searchKey[i:], buf) {
+							return true
+						}
+					}
+				}
+				if edgeObj.check(currentKey) && edgeObj.recursiveCasePath(nextSearchKey, buf) {
+					return true
+				}
+			}
+			for _, edgeObj := range r.Pchildren {
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if edgeObj.recursiveCasePath(searchKey[i:], buf) {
+							return true
+						}
+					}
+				}
+				if edgeObj.recursiveCasePath(nextSearchKey, buf) {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, edgeObj := range r.Vchildren {
+		if edgeObj.check(searchKey) {
+			return true
+		}
+	}
+	return r.Wchildren != nil
+}
+
+// The global check functions, the check functions of each RouterFull inherit from it.
+//
+// 全局校验函数，每个RouterFull的校验函数继承于此。
+var globalRouterChecks = newCheckRegistry(nil)
 
 func init() {
 	// RouterCheckFunc
-	globalRouterCheckFunc["isnum"] = routerCheckFuncIsnm
-	globalRouterCheckFunc["nozero"] = routerCheckFuncNozero
+	globalRouterChecks.funcs["isnum"] = routerCheckFuncIsnm
+	globalRouterChecks.funcs["nozero"] = routerCheckFuncNozero
+	globalRouterChecks.funcs["uuid"] = routerCheckFuncUUID
+	globalRouterChecks.funcs["alpha"] = routerCheckFuncAlpha
+	globalRouterChecks.funcs["alnum"] = routerCheckFuncAlnum
+	globalRouterChecks.funcs["hex"] = routerCheckFuncHex
+	globalRouterChecks.funcs["base64url"] = routerCheckFuncBase64url
+	globalRouterChecks.funcs["int64"] = routerCheckFuncInt64
+	globalRouterChecks.funcs["uint"] = routerCheckFuncUint
+	globalRouterChecks.funcs["float"] = routerCheckFuncFloat
 	// RouterNewCheckFunc
-	globalRouterNewCheckFunc["min"] = routerNewCheckFuncMin
-	globalRouterNewCheckFunc["max"] = routerNewCheckFuncMax
-	globalRouterNewCheckFunc["regexp"] = routerNewCheckFuncRegexp
+	globalRouterChecks.newfuncs["min"] = routerNewCheckFuncMin
+	globalRouterChecks.newfuncs["max"] = routerNewCheckFuncMax
+	globalRouterChecks.newfuncs["regexp"] = routerNewCheckFuncRegexp
+	globalRouterChecks.newfuncs["date"] = routerNewCheckFuncDate
+	globalRouterChecks.newfuncs["len"] = routerNewCheckFuncLen
+	globalRouterChecks.newfuncs["in"] = routerNewCheckFuncIn
+	globalRouterChecks.newfuncs["prefix"] = routerNewCheckFuncPrefix
+	globalRouterChecks.newfuncs["suffix"] = routerNewCheckFuncSuffix
+	globalRouterChecks.newfuncs["int64"] = routerNewCheckFuncInt64
+	globalRouterChecks.newfuncs["uint"] = routerNewCheckFuncUint
+	globalRouterChecks.newfuncs["float"] = routerNewCheckFuncFloat
 }
 
-// SetRouterCheckFunc 保存一个RouterCheckFunc函数，用于参数校验使用。
+// SetRouterCheckFunc 保存一个全局RouterCheckFunc函数，用于参数校验使用，可以并发调用。
 func SetRouterCheckFunc(name string, fn RouterCheckFunc) {
-	globalRouterCheckFunc[name] = fn
+	globalRouterChecks.setCheckFunc(name, fn)
 }
 
-// GetRouterCheckFunc 获得一个RouterCheckFunc函数
+// GetRouterCheckFunc 获得一个全局RouterCheckFunc函数
 func GetRouterCheckFunc(name string) RouterCheckFunc {
-	return globalRouterCheckFunc[name]
+	return globalRouterChecks.getCheckFunc(name)
 }
 
 func routerCheckFuncIsnm(arg string) bool {
@@ -598,14 +1396,105 @@ func routerCheckFuncNozero(arg string) bool {
 	return len(arg) != 0
 }
 
-// SetRouterNewCheckFunc 保存一个RouterNewCheckFunc函数，用于参数动态校验使用。
+// 校验uuid格式，例如123e4567-e89b-12d3-a456-426614174000，不区分大小写。
+func routerCheckFuncUUID(arg string) bool {
+	if len(arg) != 36 {
+		return false
+	}
+	for i := 0; i < len(arg); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if arg[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexChar(arg[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func routerCheckFuncAlpha(arg string) bool {
+	if len(arg) == 0 {
+		return false
+	}
+	for i := 0; i < len(arg); i++ {
+		if !isAlphaChar(arg[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func routerCheckFuncAlnum(arg string) bool {
+	if len(arg) == 0 {
+		return false
+	}
+	for i := 0; i < len(arg); i++ {
+		if !isAlphaChar(arg[i]) && (arg[i] < '0' || arg[i] > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func routerCheckFuncHex(arg string) bool {
+	if len(arg) == 0 {
+		return false
+	}
+	for i := 0; i < len(arg); i++ {
+		if !isHexChar(arg[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 校验url安全的base64编码，末尾的填充'='可以省略。
+func routerCheckFuncBase64url(arg string) bool {
+	if len(arg) == 0 {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(arg, "="))
+	return err == nil
+}
+
+// 校验int64数字，溢出时解析失败。
+func routerCheckFuncInt64(arg string) bool {
+	_, err := strconv.ParseInt(arg, 10, 64)
+	return err == nil
+}
+
+// 校验无符号数字，溢出时解析失败。
+func routerCheckFuncUint(arg string) bool {
+	_, err := strconv.ParseUint(arg, 10, 64)
+	return err == nil
+}
+
+// 校验有限的浮点数，溢出、NaN和Inf校验失败。
+func routerCheckFuncFloat(arg string) bool {
+	_, err := parseFiniteFloat(arg)
+	return err == nil
+}
+
+func isAlphaChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHexChar(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// SetRouterNewCheckFunc 保存一个全局RouterNewCheckFunc函数，用于参数动态校验使用，可以并发调用。
 func SetRouterNewCheckFunc(name string, fn RouterNewCheckFunc) {
-	globalRouterNewCheckFunc[name] = fn
+	globalRouterChecks.setNewCheckFunc(name, fn)
 }
 
-// GetRouterNewCheckFunc 获得一个RouterNewCheckFunc函数
+// GetRouterNewCheckFunc 获得一个全局RouterNewCheckFunc函数
 func GetRouterNewCheckFunc(name string) RouterNewCheckFunc {
-	return globalRouterNewCheckFunc[name]
+	return globalRouterChecks.getNewCheckFunc(name)
 }
 
 func routerNewCheckFuncMin(str string) RouterCheckFunc {
@@ -646,3 +1535,121 @@ func routerNewCheckFuncRegexp(str string) RouterCheckFunc {
 		return re.MatchString(arg)
 	}
 }
+
+// 校验日期格式，参数为time.Parse的layout，例如date:2006-01-02。
+func routerNewCheckFuncDate(str string) RouterCheckFunc {
+	return func(arg string) bool {
+		_, err := time.Parse(str, arg)
+		return err == nil
+	}
+}
+
+// 校验字符串长度，参数为长度范围或固定长度，例如len:3-16、len:8。
+func routerNewCheckFuncLen(str string) RouterCheckFunc {
+	min, max, ok := splitCheckRange(str)
+	if !ok {
+		min, max = str, str
+	}
+	n1, err1 := strconv.Atoi(min)
+	n2, err2 := strconv.Atoi(max)
+	if err1 != nil || err2 != nil || n1 < 0 || n1 > n2 {
+		return nil
+	}
+	return func(arg string) bool {
+		return n1 <= len(arg) && len(arg) <= n2
+	}
+}
+
+// 校验字符串是否为逗号分隔的值之一，例如in:red,green,blue。
+func routerNewCheckFuncIn(str string) RouterCheckFunc {
+	vals := strings.Split(str, ",")
+	return func(arg string) bool {
+		return stringSliceContains(vals, arg)
+	}
+}
+
+func routerNewCheckFuncPrefix(str string) RouterCheckFunc {
+	return func(arg string) bool {
+		return strings.HasPrefix(arg, str)
+	}
+}
+
+func routerNewCheckFuncSuffix(str string) RouterCheckFunc {
+	return func(arg string) bool {
+		return strings.HasSuffix(arg, str)
+	}
+}
+
+// 校验int64数字的范围，例如int64:-10-10，溢出时解析失败。
+func routerNewCheckFuncInt64(str string) RouterCheckFunc {
+	min, max, ok := splitCheckRange(str)
+	if !ok {
+		return nil
+	}
+	n1, err1 := strconv.ParseInt(min, 10, 64)
+	n2, err2 := strconv.ParseInt(max, 10, 64)
+	if err1 != nil || err2 != nil || n1 > n2 {
+		return nil
+	}
+	return func(arg string) bool {
+		num, err := strconv.ParseInt(arg, 10, 64)
+		return err == nil && n1 <= num && num <= n2
+	}
+}
+
+// 校验无符号数字的范围，例如uint:1-1000，溢出时解析失败。
+func routerNewCheckFuncUint(str string) RouterCheckFunc {
+	min, max, ok := splitCheckRange(str)
+	if !ok {
+		return nil
+	}
+	n1, err1 := strconv.ParseUint(min, 10, 64)
+	n2, err2 := strconv.ParseUint(max, 10, 64)
+	if err1 != nil || err2 != nil || n1 > n2 {
+		return nil
+	}
+	return func(arg string) bool {
+		num, err := strconv.ParseUint(arg, 10, 64)
+		return err == nil && n1 <= num && num <= n2
+	}
+}
+
+// 校验浮点数的范围，例如float:-1.5-1e3，溢出、NaN和Inf校验失败。
+func routerNewCheckFuncFloat(str string) RouterCheckFunc {
+	min, max, ok := splitCheckRange(str)
+	if !ok {
+		return nil
+	}
+	n1, err1 := parseFiniteFloat(min)
+	n2, err2 := parseFiniteFloat(max)
+	if err1 != nil || err2 != nil || n1 > n2 {
+		return nil
+	}
+	return func(arg string) bool {
+		num, err := parseFiniteFloat(arg)
+		return err == nil && n1 <= num && num <= n2
+	}
+}
+
+// Split the range of the check function into min and max, the separator is the '-' that is not a sign, such as "-10--1" and "1e-3-1".
+//
+// 将校验函数的范围切割为最小值和最大值，分隔符为不是符号的'-'，例如"-10--1"和"1e-3-1"。
+func splitCheckRange(str string) (string, string, bool) {
+	for i := 1; i < len(str); i++ {
+		if str[i] == '-' && str[i-1] != '-' && str[i-1] != 'e' && str[i-1] != 'E' {
+			return str[:i], str[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// Parse the finite float, return an error if overflow, NaN or Inf.
+//
+// 解析有限的浮点数，溢出、NaN或Inf返回错误。
+func parseFiniteFloat(str string) (float64, error) {
+	num, err := strconv.ParseFloat(str, 64)
+	if err == nil && (math.IsNaN(num) || math.IsInf(num, 0)) {
+		err = strconv.ErrRange
+	}
+	return num, err
+}
@@ -0,0 +1,168 @@
+package erouter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouterFullNewCheckFuncCache(t *testing.T) {
+	SetRouterNewCheckFunc("testcache", func(string) RouterCheckFunc {
+		return func(string) bool { return false }
+	})
+	r := NewRouterFull()
+	r.Get("/a/:n|testcache:1", newTestHandler("n"))
+	SetRouterNewCheckFunc("testcache", func(string) RouterCheckFunc {
+		return func(string) bool { return true }
+	})
+	r.Get("/b/:n|testcache:1", newTestHandler("n"))
+	for path, code := range map[string]int{"/a/x": 404, "/b/x": 200} {
+		if got, body := doTestRequest(r, "GET", path); got != code {
+			t.Errorf("GET %s: %d %q, want %d", path, got, body, code)
+		}
+	}
+}
+
+func TestRouterFullLoadFindFunc(t *testing.T) {
+	for path, want := range map[string][]string{
+		`:date|^(?P<year>\d{4})-(?P<month>\d{2})$`:        {"", "year", "month"},
+		`:date|isnum||^(?P<year>\d{4})-(?P<month>\d{2})$`: {"", "year", "month"},
+		`*file|^(?P<dir>.*)/(?P<name>[^/]*)$`:             {"", "dir", "name"},
+		`:date|^(\d{4})-(\d{2})$`:                         nil,
+		`:date|^\d{4}-\d{2}$`:                             nil,
+		`:id|isnum`:                                       nil,
+		`:id|!^(?P<x>a)$`:                                 nil,
+		`:id`:                                             nil,
+	} {
+		names, find := loadFindFunc(path)
+		if !reflect.DeepEqual(names, want) || (find == nil) != (want == nil) {
+			t.Errorf("%s: names %q, want %q", path, names, want)
+		}
+	}
+
+	r := NewRouterFull()
+	r.Get(`/d/:date|^(?P<year>\d{4})-(?P<month>\d{2})$`, newTestHandler("date", "year", "month"))
+	r.Get(`/n/:date|^(\d{4})-(\d{2})$`, newTestHandler("date", "year"))
+	r.Get(`/f/*file|^(?P<dir>.*)/(?P<name>[^/]*)$`, newTestHandler("file", "dir", "name"))
+	for path, body := range map[string]string{
+		"/d/2020-05":   `/d/:date|^(?P<year>\d{4})-(?P<month>\d{2})$ date=2020-05 year=2020 month=05`,
+		"/n/2020-05":   `/n/:date|^(\d{4})-(\d{2})$ date=2020-05 year=`,
+		"/f/a/b/c.txt": `/f/*file|^(?P<dir>.*)/(?P<name>[^/]*)$ file=a/b/c.txt dir=a/b name=c.txt`,
+	} {
+		if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+			t.Errorf("GET %s: %d %q, want %q", path, code, got, body)
+		}
+	}
+	if code, _ := doTestRequest(r, "GET", "/d/2020-5"); code != 404 {
+		t.Errorf("GET /d/2020-5: %d, want 404", code)
+	}
+}
+
+func TestRouterFullCheckFuncs(t *testing.T) {
+	for check, vals := range map[string][2][]string{
+		"uuid":              {{"123e4567-e89b-12d3-a456-426614174000", "123E4567-E89B-12D3-A456-426614174000"}, {"123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-42661417400g"}},
+		"alpha":             {{"abc", "ABC"}, {"a1", "a_b"}},
+		"alnum":             {{"abc", "a1B2"}, {"a-1", "a_b"}},
+		"hex":               {{"0f", "DEADbeef"}, {"0x1f", "g"}},
+		"base64url":         {{"aGk", "aGk=", "-_8"}, {"a+b", "a/b", "a"}},
+		"date:2006-01-02":   {{"2020-02-29"}, {"2019-02-29", "2020-2-1", "20200101"}},
+		"len:3-16":          {{"abc", "abcdefghijklmnop"}, {"ab", "abcdefghijklmnopq"}},
+		"len:8":             {{"abcdefgh"}, {"abcdefg", "abcdefghi"}},
+		"in:red,green,blue": {{"red", "blue"}, {"r", "Red", "redgreen"}},
+		"prefix:img_":       {{"img_1", "img_"}, {"img", "x_img_1"}},
+		"suffix:.png":       {{"a.png", ".png"}, {"a.jpg", "a.png1"}},
+		"int64":             {{"-9223372036854775808", "9223372036854775807"}, {"9223372036854775808", "-9223372036854775809", "1.0"}},
+		"int64:-10-10":      {{"-10", "0", "10"}, {"-11", "11", "9223372036854775808"}},
+		"uint":              {{"0", "18446744073709551615"}, {"-1", "18446744073709551616"}},
+		"uint:1-1000":       {{"1", "1000"}, {"0", "1001", "18446744073709551616"}},
+		"float":             {{"1.5", "-1e3", "0"}, {"1e309", "NaN", "Inf", "a"}},
+		"float:-1.5-1e3":    {{"-1.5", "0", "1000"}, {"-1.6", "1000.1", "1e309", "NaN"}},
+	} {
+		r := NewRouterFull()
+		r.Get("/p/:v|"+check, newTestHandler("v"))
+		r.Get("/w/*v|"+check, newTestHandler("v"))
+		if err := r.Err(); err != nil {
+			t.Errorf("%s: %v", check, err)
+			continue
+		}
+		for _, prefix := range []string{"/p/", "/w/"} {
+			for _, val := range vals[0] {
+				if code, _ := doTestRequest(r, "GET", prefix+val); code != 200 {
+					t.Errorf("%s %s%s: %d, want 200", check, prefix, val, code)
+				}
+			}
+			for _, val := range vals[1] {
+				if code, _ := doTestRequest(r, "GET", prefix+val); code != 404 {
+					t.Errorf("%s %s%s: %d, want 404", check, prefix, val, code)
+				}
+			}
+		}
+	}
+}
+
+func TestRouterFullCheckFuncsInvalid(t *testing.T) {
+	for _, check := range []string{"len:16-3", "len:x", "int64:1", "int64:0-9223372036854775808", "uint:-1-1", "float:1-NaN", "notexist"} {
+		r := NewRouterFull()
+		r.Get("/p/:v|"+check, newTestHandler("v"))
+		if r.Err() == nil {
+			t.Errorf("%s: want a registration error", check)
+		}
+	}
+}
+
+func TestRouterFullCheckChain(t *testing.T) {
+	r := NewRouterFull()
+	r.Get("/id/:id|isnum|min:1|max:1000", newTestHandler("id"))
+	r.Get("/name/:name|!in:admin,root", newTestHandler("name"))
+	r.Get("/key/:key|uuid||isnum|min:1", newTestHandler("key"))
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for path, code := range map[string]int{
+		"/id/0":        404,
+		"/id/1":        200,
+		"/id/1000":     200,
+		"/id/1001":     404,
+		"/id/x":        404,
+		"/name/eudore": 200,
+		"/name/admin":  404,
+		"/name/root":   404,
+		"/key/123e4567-e89b-12d3-a456-426614174000": 200,
+		"/key/5": 200,
+		"/key/0": 404,
+		"/key/x": 404,
+	} {
+		if got, body := doTestRequest(r, "GET", path); got != code {
+			t.Errorf("GET %s: %d %q, want %d", path, got, body, code)
+		}
+	}
+
+	r = NewRouterFull()
+	r.Get("/id/:id|isnum|notexist:1", newTestHandler("id"))
+	if err := r.Err(); err == nil || !strings.Contains(err.Error(), "notexist:1") {
+		t.Errorf("unknown check link: %v", err)
+	}
+}
+
+func TestRouterFullCheckParamInSegment(t *testing.T) {
+	r := NewRouterFull()
+	r.Get("/files/:name|alpha.:ext", newTestHandler("name", "ext"))
+	r.Get("/files/:name|suffix:.png", newTestHandler("name"))
+	r.Get("/ids/:id|isnum-:key", newTestHandler("id", "key"))
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for path, body := range map[string]string{
+		"/files/a.txt":    "/files/:name|alpha.:ext name=a ext=txt",
+		"/files/a.tar.gz": "/files/:name|alpha.:ext name=a ext=tar.gz",
+		"/files/a1.png":   "/files/:name|suffix:.png name=a1.png",
+		"/ids/12-34-56":   "/ids/:id|isnum-:key id=12 key=34-56",
+	} {
+		if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+			t.Errorf("GET %s: %d %q, want %q", path, code, got, body)
+		}
+	}
+	if code, _ := doTestRequest(r, "GET", "/files/a1.txt"); code != 404 {
+		t.Errorf("GET /files/a1.txt: %d, want 404", code)
+	}
+}
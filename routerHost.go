@@ -24,9 +24,9 @@ func NewRouterHost() Router {
 }
 
 func (r *RouterHost) getRouter(path string) Router {
-	args := strings.Split(path, " ")
+	args := splitRouteArgs(path)
 	for _, arg := range args[1:] {
-		if arg[:5] == "host=" {
+		if strings.HasPrefix(arg, "host=") {
 			return r.matchRouter(arg[5:])
 		}
 	}
@@ -61,13 +61,69 @@ func (r *RouterHost) RegisterHost(host string, router Router) {
 }
 
 // RegisterMiddleware 从路径参数中获得host参数，选择对应子路由器注册中间件函数。
-func (r *RouterHost) RegisterMiddleware(method, path string, hs []Middleware) {
-	r.getRouter(path).RegisterMiddleware(method, path, hs)
+func (r *RouterHost) RegisterMiddleware(method, path string, hs []Middleware) error {
+	return r.getRouter(path).RegisterMiddleware(method, path, hs)
 }
 
 // RegisterHandler 从路径参数中获得host参数，选择对应子路由器注册新路由。
-func (r *RouterHost) RegisterHandler(method string, path string, handler Handler) {
-	r.getRouter(path).RegisterHandler(method, path, handler)
+func (r *RouterHost) RegisterHandler(method string, path string, handler Handler) error {
+	return r.getRouter(path).RegisterHandler(method, path, handler)
+}
+
+// RemoveMiddleware 从路径参数中获得host参数，选择对应子路由器删除中间件。
+func (r *RouterHost) RemoveMiddleware(method, path, name string) {
+	r.getRouter(path).RemoveMiddleware(method, path, name)
+}
+
+// RemoveHandler 从路径参数中获得host参数，选择对应子路由器删除路由。
+func (r *RouterHost) RemoveHandler(method string, path string) {
+	r.getRouter(path).RemoveHandler(method, path)
+}
+
+// ReplaceHandler 从路径参数中获得host参数，选择对应子路由器替换路由处理者。
+func (r *RouterHost) ReplaceHandler(method string, path string, handler Handler) {
+	r.getRouter(path).ReplaceHandler(method, path, handler)
+}
+
+// Routes 返回默认子路由器和全部Host子路由器的路由信息，Host子路由器的路由会附加匹配的Host。
+func (r *RouterHost) Routes() []RouteInfo {
+	routes := r.Default.Routes()
+	for i, router := range r.Routers {
+		for _, route := range router.Routes() {
+			route.Host = r.Hosts[i]
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// URL 依次使用默认子路由器和Host子路由器创建名称为name的路由url。
+func (r *RouterHost) URL(name string, args ...string) (string, error) {
+	for _, router := range append([]Router{r.Default}, r.Routers...) {
+		url, err := router.URL(name, args...)
+		if _, ok := err.(routeNameError); !ok {
+			return url, err
+		}
+	}
+	return "", routeNameError(name)
+}
+
+// Err 返回默认子路由器和全部Host子路由器注册失败的错误，没有错误返回nil。
+func (r *RouterHost) Err() error {
+	var errs RouteErrors
+	for _, router := range append([]Router{r.Default}, r.Routers...) {
+		switch err := router.Err().(type) {
+		case nil:
+		case RouteErrors:
+			errs = append(errs, err...)
+		default:
+			errs = append(errs, &RouteError{Position: -1, Reason: err.Error()})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
 }
 
 // ServeHTTP 获取请求的Host匹配对应子路由器处理http请求。
@@ -0,0 +1,70 @@
+package erouter
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试RouterHost的请求，返回状态码和body
+func doTestHostRequest(r Router, host, path string) (int, string) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	req.Host = host
+	r.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestRouterHostRemoveHandler(t *testing.T) {
+	r := NewRouterHost().(*RouterHost)
+	r.RegisterHost("*.example.com", NewRouterFull())
+	r.Get("/r", newTestHandler())
+	r.Get("/r host=api.example.com", newTestHandler())
+	r.Get("/s host=api.example.com", newTestHandler())
+	r.RemoveHandler("GET", "/r host=api.example.com")
+	r.ReplaceHandler("GET", "/s host=api.example.com", newTestHandler(ParamRoute))
+	for _, c := range []struct {
+		host, path string
+		code       int
+		body       string
+	}{
+		{"example.com", "/r", 200, "/r"},
+		{"api.example.com", "/r", 404, "404 page not found\n"},
+		{"api.example.com", "/s", 200, "/s route=/s"},
+	} {
+		if code, body := doTestHostRequest(r, c.host, c.path); code != c.code || body != c.body {
+			t.Errorf("%s%s: %d %q, want %d %q", c.host, c.path, code, body, c.code, c.body)
+		}
+	}
+}
+
+func TestRouterHostURL(t *testing.T) {
+	r := NewRouterHost().(*RouterHost)
+	r.RegisterHost("api.example.com", NewRouterFull())
+	r.Get("/home name=home", newTestHandler())
+	r.Get("/users/:id|isnum name=user host=api.example.com", newTestHandler())
+	for name, want := range map[string]string{"home": "/home", "user": "/users/1"} {
+		if got, err := r.URL(name, "id", "1"); err != nil || got != want {
+			t.Errorf("URL %s: %q %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := r.URL("user", "id", "x"); err == nil {
+		t.Error("URL user x: want a check error")
+	}
+	if _, err := r.URL("notexist"); err == nil {
+		t.Error("URL notexist: want an error")
+	}
+}
+
+func TestRouterHostRoutes(t *testing.T) {
+	r := NewRouterHost().(*RouterHost)
+	r.RegisterHost("api.example.com", NewRouterFull())
+	r.Get("/a", newTestHandler())
+	r.Get("/b host=api.example.com", newTestHandler())
+	hosts := make(map[string]string)
+	for _, route := range r.Routes() {
+		hosts[route.Path] = route.Host
+	}
+	if len(hosts) != 2 || hosts["/a"] != "" || hosts["/b"] != "api.example.com" {
+		t.Errorf("routes hosts: %v", hosts)
+	}
+}
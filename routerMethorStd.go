@@ -1,9 +1,5 @@
 package erouter
 
-import (
-	"strings"
-)
-
 type (
 	// RouterMethodStd 默认路由器方法添加一个实现
 	RouterMethodStd struct {
@@ -15,10 +11,10 @@ type (
 
 // Group 返回一个组路由方法。
 func (m *RouterMethodStd) Group(path string) RouterMethod {
-	// 将路径前缀和路径参数分割出来
-	args := strings.Split(path, " ")
-	prefix := args[0]
-	tags := path[len(prefix):]
+	// 将路径前缀和路径参数分割出来，保留原始字符串在注册时切割
+	_, n := scanRouteArg(path, true)
+	prefix := path[:n]
+	tags := path[n:]
 
 	// 构建新的路由方法配置器
 	return &RouterMethodStd{
@@ -58,6 +54,11 @@ func (m *RouterMethodStd) MethodNotAllowed(h Handler) {
 	m.RouterCore.RegisterHandler("405", "", h)
 }
 
+// NotAcceptable 设置406处理。
+func (m *RouterMethodStd) NotAcceptable(h Handler) {
+	m.RouterCore.RegisterHandler("406", "", h)
+}
+
 // Any Router Register handler。
 func (m *RouterMethodStd) Any(path string, h Handler) {
 	m.registerHandlers(MethodAny, path, h)
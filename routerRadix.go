@@ -13,7 +13,6 @@ const (
 	radixNodeKindConst uint8 = 1 << iota
 	radixNodeKindParam
 	radixNodeKindWildcard
-	radixNodeKindAnyMethod
 )
 
 type (
@@ -26,25 +25,50 @@ type (
 	// 具有零内存复制、严格路由匹配顺序、组路由、中间件功能、默认参数、常量匹配、变量匹配、通配符匹配、变量校验匹配、通配符校验匹配、基于Host路由这些特点功能。
 	RouterRadix struct {
 		RouterMethod
-		// save middleware
-		// 保存注册的中间件信息
-		middtree *middNode
+		// The methods registered by Any, default is a copy of RouterAllMethod.
+		//
+		// Any注册的方法集合，默认为RouterAllMethod的复制。
+		AnyMethods []string
+		// If enabled, OPTIONS requests for registered paths are answered automatically.
+		//
+		// 开启后自动响应已注册路径的OPTIONS请求，显式注册的Options处理优先。
+		AutoOptions bool
+		// If enabled, HEAD requests without a HEAD route are handled by the GET route and the body is discarded.
+		//
+		// 开启后HEAD请求未匹配时使用GET路由处理，响应body会被丢弃。
+		ImplicitHead bool
+		// If enabled, when the path is not matched, redirect to the path that toggled the trailing slash.
+		//
+		// 开启后路径未匹配时重定向到切换末尾'/'的路径，可以使用redirect标签给Group单独设置。
+		RedirectTrailingSlash bool
+		// If enabled, when the path is not matched, redirect to the cleaned path.
+		//
+		// 开启后路径未匹配时重定向到清理后的路径，可以使用redirect标签给Group单独设置。
+		RedirectFixedPath bool
+		// If enabled, when the path is not matched, redirect to the path that uses the case of the registered constants.
+		//
+		// 开启后路径未匹配时重定向到常量使用注册大小写的路径，参数值保持请求的大小写，可以使用redirect标签给Group单独设置。
+		RedirectFixedCase bool
+		// If enabled, the constants are matched case-insensitively and the param values are kept as sent, it must be set before registering routes.
+		//
+		// 开启后常量忽略大小写匹配，参数值保持请求的大小写，需要在注册路由前设置。
+		CaseInsensitive bool
+		// If enabled, registration modifies a copy of the routing data and replaces it atomically, routes can be registered while serving.
+		//
+		// 开启后注册时修改路由数据的副本，然后使用原子操作替换，可以在处理请求时注册路由。
+		CopyOnWrite bool
+		// If enabled, duplicate routes, routes shadowed by other routes and parameter name clashes fail to register.
+		//
+		// 开启后注册重复路由、被其他路由遮蔽的路由和参数名称冲突时返回错误，信息包含两次注册的文件和行号。
+		Strict bool
 		// exception handling method
 		// 异常处理方法
-		node404     radixNode
 		nodefunc404 Handler
-		node405     radixNode
 		nodefunc405 Handler
-		// various methods routing tree
-		// 各种方法路由树
-		root    radixNode
-		get     radixNode
-		post    radixNode
-		put     radixNode
-		delete  radixNode
-		options radixNode
-		head    radixNode
-		patch   radixNode
+		nodefunc406 Handler
+		// routing data and registration errors
+		// 路由数据和注册失败的错误
+		routerStore
 	}
 	// radix节点的定义
 	radixNode struct {
@@ -56,32 +80,42 @@ type (
 		Cchildren []*radixNode
 		Pchildren []*radixNode
 		Wchildren *radixNode
-		// 当前节点的数据
-		tags     []string
-		vals     []string
-		handlers Handler
+		// 当前节点的路由数据
+		routeData
 	}
 )
 
 // NewRouterRadix 创建一个Radix路由器，基于基数数实现基本路由器功能。
 func NewRouterRadix() Router {
 	router := &RouterRadix{
-		middtree:    &middNode{},
+		AnyMethods:  append([]string{}, RouterAllMethod...),
 		nodefunc404: defaultRouter404Func,
 		nodefunc405: defaultRouter405Func,
-		node404: radixNode{
+		nodefunc406: defaultRouter406Func,
+	}
+	trees := &routerTrees{
+		middtree: &middTree{},
+		names:    make(map[string]string),
+		node404: routeData{
 			tags:     []string{ParamRoute},
 			vals:     []string{"404"},
 			handlers: defaultRouter404Func,
 		},
-		node405: radixNode{
-			Wchildren: &radixNode{
-				tags:     []string{ParamRoute},
-				vals:     []string{"405"},
-				handlers: defaultRouter405Func,
-			},
+		node405: routeData{
+			tags:     []string{ParamRoute},
+			vals:     []string{"405"},
+			handlers: defaultRouter405Func,
 		},
+		node406: routeData{
+			tags:     []string{ParamRoute},
+			vals:     []string{"406"},
+			handlers: defaultRouter406Func,
+		},
+	}
+	for _, method := range RouterAllMethod {
+		trees.newTree(method, &radixNode{})
 	}
+	router.trees.Store(trees)
 	router.RouterMethod = &RouterMethodStd{
 		RouterCore: router,
 	}
@@ -92,29 +126,49 @@ func NewRouterRadix() Router {
 //
 // If the method is not empty, the path is empty and the modified path is '/'.
 //
+// The path is a scope using the same grammar as the route, matching routes on segment boundaries.
+//
 // RegisterMiddleware注册中间件到中间件树中，如果存在则追加处理者。
 //
 // 如果方法非空，路径为空，修改路径为'/'。
-func (r *RouterRadix) RegisterMiddleware(method, path string, hs []Middleware) {
-	if pos := strings.IndexByte(path, ' '); pos != -1 {
-		path = path[:pos]
-	}
+//
+// 路径是和路由语法相同的作用域，按照路径段边界匹配路由。
+func (r *RouterRadix) RegisterMiddleware(method, path string, hs []Middleware) error {
+	// 分离路径中的参数，mwname参数为中间件的名称
+	args := splitRouteArgs(path)
+	path = args[0]
 	if len(method) != 0 && len(path) == 0 {
 		path = "/"
 	}
-	if method == MethodAny {
-		if path == "/" {
-			r.middtree.Insert("", hs)
-			r.node404.handlers = CombineHandler(r.nodefunc404, r.middtree.val)
-			r.node405.Wchildren.handlers = CombineHandler(r.nodefunc405, r.middtree.val)
-			return
-		}
-		for _, method = range RouterAllMethod {
-			r.middtree.Insert(method+path, hs)
-		}
-	} else {
-		r.middtree.Insert(method+path, hs)
+	trees := r.lockTrees(r.CopyOnWrite)
+	defer r.unlockTrees(trees)
+	trees.middtree.Insert(method, path, getRouteTag(args, ParamMwname), hs)
+	trees.node404.handlers = CombineHandler(r.nodefunc404, trees.middtree.val)
+	trees.node405.handlers = CombineHandler(r.nodefunc405, trees.middtree.val)
+	trees.node406.handlers = CombineHandler(r.nodefunc406, trees.middtree.val)
+	r.combineHandlers(trees)
+	return nil
+}
+
+// RemoveMiddleware method remove the middlewares named name from the scope of the method and path, and combine the handlers of the routes again.
+//
+// If name is empty, remove all middlewares of the scope; the name of the middleware is set by the mwname tag, such as "/ mwname=logger".
+//
+// RemoveMiddleware从方法和路径的作用域删除名称为name的中间件，然后重新组合路由的处理者。
+//
+// 如果name为空删除作用域的全部中间件；中间件的名称使用mwname标签设置，例如"/ mwname=logger"。
+func (r *RouterRadix) RemoveMiddleware(method, path, name string) {
+	path = splitRouteArgs(path)[0]
+	if len(method) != 0 && len(path) == 0 {
+		path = "/"
 	}
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	trees.middtree.Remove(method, path, name)
+	trees.node404.handlers = CombineHandler(r.nodefunc404, trees.middtree.val)
+	trees.node405.handlers = CombineHandler(r.nodefunc405, trees.middtree.val)
+	trees.node406.handlers = CombineHandler(r.nodefunc406, trees.middtree.val)
+	r.combineHandlers(trees)
 }
 
 // RegisterHandler method register a new method request path to the router
@@ -124,59 +178,198 @@ func (r *RouterRadix) RegisterMiddleware(method, path string, hs []Middleware) {
 // RegisterHandler给路由器注册一个新的方法请求路径
 //
 // 路由器会从中间件树中匹配当前路径可使用的处理者，并添加到处理者前方。
-func (r *RouterRadix) RegisterHandler(method string, path string, handler Handler) {
+func (r *RouterRadix) RegisterHandler(method string, path string, handler Handler) error {
+	trees := r.lockTrees(r.CopyOnWrite)
+	defer r.unlockTrees(trees)
+	var err *RouteError
 	switch method {
 	case "NotFound", "404":
 		r.nodefunc404 = handler
-		r.node404.handlers = CombineHandler(handler, r.middtree.val)
+		trees.node404.handlers = CombineHandler(handler, trees.middtree.val)
 	case "MethodNotAllowed", "405":
 		r.nodefunc405 = handler
-		r.node405.Wchildren.handlers = CombineHandler(handler, r.middtree.val)
+		trees.node405.handlers = CombineHandler(handler, trees.middtree.val)
+	case "NotAcceptable", "406":
+		r.nodefunc406 = handler
+		trees.node406.handlers = CombineHandler(handler, trees.middtree.val)
 	case MethodAny:
-		for _, method := range RouterAllMethod {
-			r.insertRoute(method, path, true, CombineHandler(handler, r.middtree.Lookup(method+path)))
-		}
+		err = r.insertRoute(trees, r.AnyMethods, path, true, handler)
 	default:
-		r.insertRoute(method, path, false, CombineHandler(handler, r.middtree.Lookup(method+path)))
+		err = r.insertRoute(trees, []string{method}, path, false, handler)
 	}
+	return r.addError(err)
 }
 
 // Add a new routing node.
 //
-// If the method is not supported, it will not be added. Requesting the path will respond 405.
+// The route is added to each method, all the methods are checked before inserting, a registration that returns an error does not modify the routes.
+// If the method tree does not exist, it is created on demand; a method that is not a valid token returns an error.
 //
 // Cut the path by node type. Each path is a type of node, then append to the tree in turn, and then set the data to the last node.
 //
+// The route with optional params is added to each path, the default values are added to the tags of the path.
+//
+// The route with header, query or cookie constraint tags is added as a guard of the node, the route without constraints is the fallback.
+//
 // Path cut see getSpiltPath function, currently not perfect, processing regularity may be abnormal.
 //
 // 添加一个新的路由节点。
 //
-// 如果方法不支持则不会添加，请求该路径会响应405.
+// 路由添加到每个方法，插入前检查全部方法，返回错误的注册不会修改路由。
+// 如果方法树不存在会按需创建，方法不是有效的token返回错误。
 //
 // 将路径按节点类型切割，每段路径即为一种类型的节点，然后依次向树追加，然后给最后的节点设置数据。
 //
+// 带有可选参数的路由会添加到每个路径，默认值添加到路径的标签。
+//
+// 带有header、query或cookie约束标签的路由添加为节点的约束处理者，没有约束的路由为默认处理者。
+//
 // 路径切割见getSpiltPath函数，当前未完善，处理正则可能异常。
-func (r *RouterRadix) insertRoute(method, key string, isany bool, val Handler) {
-	var currentNode *radixNode = r.getTree(method)
-	if currentNode == &r.node405 {
-		return
+func (r *RouterRadix) insertRoute(trees *routerTrees, methods []string, key string, isany bool, handler Handler) *RouteError {
+	if len(methods) == 0 {
+		return nil
+	}
+	pattern, err := parsePattern(key)
+	if err != nil {
+		err.Method = methods[0]
+		return err
 	}
+	if r.CaseInsensitive {
+		pattern.lowerConst()
+	}
+	args := pattern.args()
 
-	// 创建节点
-	args := strings.Split(key, " ")
-	for _, path := range getSplitPath(args[0]) {
-		currentNode = currentNode.InsertNode(path, newRadixNode(path))
+	var source string
+	if r.Strict {
+		source = getCallerSource()
+	}
+	constraints := getRouteConstraints(args)
+	// 先检查全部方法，注册失败时不修改路由
+	for _, method := range methods {
+		tree, _ := trees.getTree(method).(*radixNode)
+		if tree == nil && !isMethodToken(method) {
+			return newRouteError(method, args[0], -1, "method is not a valid token")
+		}
+		if r.Strict && tree != nil {
+			if err := r.checkRoute(tree, method, pattern, args, constraints, isany, source); err != nil {
+				return err
+			}
+		}
+	}
+	name := getRouteName(args)
+	if pattern, ok := trees.names[name]; r.Strict && ok && pattern != args[0] {
+		return newRouteError(methods[0], args[0], -1, newStrictName(source, name, pattern))
+	}
+	for _, method := range methods {
+		r.insertPattern(trees, method, pattern, args, constraints, isany, handler, source)
+	}
+	if len(name) != 0 {
+		trees.names[name] = args[0]
 	}
+	trees.redirect |= getRedirectPolicy(getRouteTag(args, ParamRedirect), false, false, false)
+	return nil
+}
+
+// Check the route in strict mode before any node is inserted, a param that clashes or a route that is registered repeatedly returns an error.
+//
+// 严格模式下在插入节点前检查路由，参数冲突或路由重复注册返回错误。
+func (r *RouterRadix) checkRoute(tree *radixNode, method string, pattern *Pattern, args []string, constraints []routeConstraint, isany bool, source string) *RouteError {
+	for _, optional := range pattern.expand() {
+		var currentNode = tree
+		for _, seg := range optional.segments {
+			nextNode := newRadixNode(seg.Path)
+			if node := currentNode.getConflictNode(nextNode); node != nil {
+				return newRouteError(method, args[0], seg.Pos, newStrictConflict(source, seg.Path, node.path, node.source))
+			}
+			if currentNode = currentNode.lookupNode(seg.Path, nextNode); currentNode == nil {
+				break
+			}
+		}
+		switch {
+		case currentNode == nil:
+		case len(constraints) != 0:
+			if guard := getRouteGuard(currentNode.guards, constraints); guard != nil {
+				return newRouteError(method, args[0], -1, newStrictDuplicate(source, isany, guard.isany, guard.vals[0], guard.source))
+			}
+		case currentNode.handler != nil:
+			return newRouteError(method, args[0], -1, newStrictDuplicate(source, isany, currentNode.isany, currentNode.vals[0], currentNode.source))
+		}
+	}
+	return nil
+}
+
+// Insert the paths of the pattern to the method tree, the route has been checked.
+//
+// 将路由模式的路径插入方法树，路由已经检查。
+func (r *RouterRadix) insertPattern(trees *routerTrees, method string, pattern *Pattern, args []string, constraints []routeConstraint, isany bool, handler Handler, source string) {
+	tree, _ := trees.getTree(method).(*radixNode)
+	if tree == nil {
+		tree = &radixNode{}
+		trees.newTree(method, tree)
+	}
+	for _, optional := range pattern.expand() {
+		// 创建节点
+		var currentNode = tree
+		for _, seg := range optional.segments {
+			nextNode := newRadixNode(seg.Path)
+			currentNode = currentNode.InsertNode(seg.Path, nextNode)
+			if currentNode == nextNode {
+				currentNode.source = source
+			}
+		}
+
+		tags := append(args[:len(args):len(args)], optional.defaults...)
+		if len(constraints) != 0 {
+			guard := getRouteGuard(currentNode.guards, constraints)
+			if isany && guard != nil && !guard.isany {
+				continue
+			}
+			currentNode.guards = insertRouteGuard(currentNode.guards, newRouteGuard(tags, constraints, isany, handler, source))
+			if currentNode.tags == nil {
+				currentNode.SetTags(append([]string{args[0]}, optional.defaults...))
+			}
+			currentNode.combine(method, trees.middtree, r.handle404, r.handle406)
+			continue
+		}
 
-	if isany {
-		if currentNode.kind&radixNodeKindAnyMethod != radixNodeKindAnyMethod && currentNode.handlers != nil {
-			return
+		if isany {
+			if !currentNode.isany && currentNode.handler != nil {
+				continue
+			}
+			currentNode.isany = true
 		}
-		currentNode.kind |= radixNodeKindAnyMethod
+
+		currentNode.handler = handler
+		currentNode.source = source
+		currentNode.SetTags(tags)
+		currentNode.combine(method, trees.middtree, r.handle404, r.handle406)
 	}
+}
 
-	currentNode.handlers = val
-	currentNode.SetTags(args)
+// RemoveHandler method remove a route from the router, the empty nodes are pruned and the nodes are merged.
+//
+// The routing data is copied and modified, then replaced atomically, ANY method only removes the routes registered by Any.
+//
+// RemoveHandler从路由器删除一个路由，会裁剪空节点并合并节点。
+//
+// 路由数据会复制后修改，然后使用原子操作替换，ANY方法只删除Any注册的路由。
+func (r *RouterRadix) RemoveHandler(method string, path string) {
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	r.modifyRoutes(trees, r.AnyMethods, method, path, r.CaseInsensitive, nil)
+}
+
+// ReplaceHandler method replace the handler of a registered route, in-flight requests use the old or new handler.
+//
+// The router matches the handlers available to the current path from the middleware tree and adds them to the front of the handler.
+//
+// ReplaceHandler替换一个已注册路由的处理者，正在处理的请求使用旧的或新的处理者。
+//
+// 路由器会从中间件树中匹配当前路径可使用的处理者，并添加到处理者前方。
+func (r *RouterRadix) ReplaceHandler(method string, path string, handler Handler) {
+	trees := r.lockTrees(true)
+	defer r.unlockTrees(trees)
+	r.modifyRoutes(trees, r.AnyMethods, method, path, r.CaseInsensitive, handler)
 }
 
 // ServeHTTP 实现http.Handler接口，进行路由匹配并处理http请求。
@@ -188,52 +381,48 @@ func (r *RouterRadix) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	paramArrayPool.Put(p)
 }
 
-// Match a request, if the method does not allow direct return to node405, no match returns node404.
+// Match a request, if the path matches other methods return node405, no match returns node404.
 //
-// 匹配一个请求，如果方法不不允许直接返回node405，未匹配返回node404。
-func (r *RouterRadix) Match(method, path string, params Params) Handler {
-	if n := r.getTree(method).recursiveLoopup(path, params); n != nil {
-		return n
-	}
-
-	// 处理404
-	r.node404.AddTagsToParams(params)
-	return r.node404.handlers
-}
-
-// Create a 405 response radixNode.
+// The routing data is loaded atomically once, registration does not affect the matching request.
 //
-// 创建一个405响应的radixNode。
-func newRadixNode405(args string, h Handler) *radixNode {
-	newNode := &radixNode{
-		Wchildren: &radixNode{
-			handlers: h,
-		},
-	}
-	newNode.Wchildren.SetTags(strings.Split(args, " "))
-	return newNode
+// 匹配一个请求，如果路径可以匹配其他方法返回node405，未匹配返回node404。
+//
+// 路由数据使用原子操作加载一次，注册不会影响正在匹配的请求。
+//
+// 返回405时会将路径允许的方法使用allow参数保存，如果开启ImplicitHead和AutoOptions，HEAD和OPTIONS请求返回自动处理。
+//
+// 如果切换末尾'/'或清理后的路径可以匹配，并且路由的重定向策略允许，返回重定向处理。
+func (r *RouterRadix) Match(method, path string, params Params) Handler {
+	return r.trees.Load().(*routerTrees).match(method, path, params, routerOptions{
+		fold:    r.CaseInsensitive,
+		head:    r.ImplicitHead,
+		options: r.AutoOptions,
+		slash:   r.RedirectTrailingSlash,
+		fixed:   r.RedirectFixedPath,
+		cased:   r.RedirectFixedCase,
+	})
 }
 
 // Create a Radix tree Node that will set different node types based on the current route.
 //
 // '*' prefix is a wildcard node, ':' prefix is a parameter node, and other non-constant nodes.
 //
+// The name is the same as ParsePattern, the check functions after '|' are only used by RouterFull.
+//
 // 创建一个Radix树Node，会根据当前路由设置不同的节点类型和名称。
 //
 // '*'前缀为通配符节点，':'前缀为参数节点，其他未常量节点。
+//
+// 名称和ParsePattern相同，'|'后的校验函数仅RouterFull使用。
 func newRadixNode(path string) *radixNode {
 	newNode := &radixNode{path: path}
 	switch path[0] {
 	case '*':
 		newNode.kind = radixNodeKindWildcard
-		if len(path) == 1 {
-			newNode.name = "*"
-		} else {
-			newNode.name = path[1:]
-		}
+		newNode.name = newPatternSegment(path, 0).Name
 	case ':':
 		newNode.kind = radixNodeKindParam
-		newNode.name = path[1:]
+		newNode.name = newPatternSegment(path, 0).Name
 	default:
 		newNode.kind = radixNodeKindConst
 	}
@@ -275,7 +464,7 @@ func (r *radixNode) InsertNode(path string, nextNode *radixNode) *radixNode {
 				}
 				newNode := r.SplitNode(subStr, r.Cchildren[i].path)
 				if newNode == nil {
-					panic("Unexpect error on split node")
+					return nil
 				}
 				return newNode.InsertNode(strings.TrimPrefix(path, subStr), nextNode)
 			}
@@ -295,13 +484,67 @@ func (r *radixNode) InsertNode(path string, nextNode *radixNode) *radixNode {
 		}
 		r.Pchildren = append(r.Pchildren, nextNode)
 	case radixNodeKindWildcard:
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return r.Wchildren
+		}
 		r.Wchildren = nextNode
 	default:
-		panic("Undefined radix node type")
+		// Undefined radix node type
+		return nil
 	}
 	return nextNode
 }
 
+// Get the node that InsertNode returns for the path without modifying the tree, return nil if a new node would be created.
+//
+// 获取InsertNode对路径返回的节点但不修改树，如果会创建新节点返回nil。
+func (r *radixNode) lookupNode(path string, nextNode *radixNode) *radixNode {
+	if len(path) == 0 {
+		return r
+	}
+	switch nextNode.kind {
+	case radixNodeKindConst:
+		for _, i := range r.Cchildren {
+			if strings.HasPrefix(path, i.path) {
+				return i.lookupNode(path[len(i.path):], nextNode)
+			}
+		}
+	case radixNodeKindParam:
+		for _, i := range r.Pchildren {
+			if i.path == path {
+				return i
+			}
+		}
+	case radixNodeKindWildcard:
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return r.Wchildren
+		}
+	}
+	return nil
+}
+
+// Get the child node that conflicts with nextNode, a param or wildcard node with a different name at the same position conflicts.
+//
+// 获取和nextNode冲突的子节点，相同位置名称不同的参数或通配符节点冲突。
+func (r *radixNode) getConflictNode(nextNode *radixNode) *radixNode {
+	switch nextNode.kind {
+	case radixNodeKindParam:
+		for _, i := range r.Pchildren {
+			if i.path == nextNode.path {
+				return nil
+			}
+		}
+		if len(r.Pchildren) > 0 {
+			return r.Pchildren[0]
+		}
+	case radixNodeKindWildcard:
+		if r.Wchildren != nil && r.Wchildren.path != nextNode.path {
+			return r.Wchildren
+		}
+	}
+	return nil
+}
+
 // Bifurcate the child node whose path is edgeKey, and the fork common prefix path is pathKey.
 //
 // 对指定路径为edgeKey的子节点分叉，分叉公共前缀路径为pathKey。
@@ -319,65 +562,197 @@ func (r *radixNode) SplitNode(pathKey, edgeKey string) *radixNode {
 	return nil
 }
 
-// Set the tags for the current Node
+// Deep copy the node and its child nodes, tags and handlers are shared.
 //
-// 给当前Node设置tags
-func (r *radixNode) SetTags(args []string) {
-	if len(args) == 0 {
-		return
+// 深复制节点和子节点，tags和处理者共享。
+func (r *radixNode) clone() *radixNode {
+	newNode := *r
+	newNode.Cchildren = cloneRadixNodes(r.Cchildren)
+	newNode.Pchildren = cloneRadixNodes(r.Pchildren)
+	if r.Wchildren != nil {
+		newNode.Wchildren = r.Wchildren.clone()
+	}
+	return &newNode
+}
+
+func (r *radixNode) cloneNode() routeNode {
+	return r.clone()
+}
+
+func cloneRadixNodes(nodes []*radixNode) []*radixNode {
+	if nodes == nil {
+		return nil
+	}
+	newNodes := make([]*radixNode, len(nodes))
+	for i := range nodes {
+		newNodes[i] = nodes[i].clone()
+	}
+	return newNodes
+}
+
+// Find the child node whose path is path, append the passing nodes to nodes, return nil if not found.
+//
+// 查找路径为path的子节点，将经过的节点追加到nodes，未找到返回nil。
+func (r *radixNode) findNode(path string, nodes []routeNode) []routeNode {
+	switch path[0] {
+	case ':':
+		for _, i := range r.Pchildren {
+			if i.path == path {
+				return append(nodes, i)
+			}
+		}
+	case '*':
+		if r.Wchildren != nil && r.Wchildren.path == path {
+			return append(nodes, r.Wchildren)
+		}
+	default:
+		// 常量节点首字母不同，最多一个前缀匹配
+		for _, i := range r.Cchildren {
+			if strings.HasPrefix(path, i.path) {
+				if len(path) == len(i.path) {
+					return append(nodes, i)
+				}
+				return i.findNode(path[len(i.path):], append(nodes, i))
+			}
+		}
 	}
-	r.tags = make([]string, len(args))
-	r.vals = make([]string, len(args))
-	// The first parameter name defaults to route
-	// 第一个参数名称默认为route
-	r.tags[0] = ParamRoute
-	r.vals[0] = args[0]
-	for i, str := range args[1:] {
-		r.tags[i+1], r.vals[i+1] = split2byte(str, '=')
+	return nil
+}
+
+// Check if the node has no handler and no child nodes.
+//
+// 检查节点是否没有处理者和子节点。
+func (r *radixNode) isEmpty() bool {
+	return r.handlers == nil && len(r.Cchildren) == 0 && len(r.Pchildren) == 0 && r.Wchildren == nil
+}
+
+// Delete a child node.
+//
+// 删除一个子节点。
+func (r *radixNode) deleteNode(node routeNode) {
+	n, _ := node.(*radixNode)
+	if r.Wchildren == n {
+		r.Wchildren = nil
+	}
+	r.Cchildren = deleteRadixNode(r.Cchildren, n)
+	r.Pchildren = deleteRadixNode(r.Pchildren, n)
+}
+
+func deleteRadixNode(nodes []*radixNode, node *radixNode) []*radixNode {
+	for i := range nodes {
+		if nodes[i] == node {
+			return append(nodes[:i], nodes[i+1:]...)
+		}
 	}
+	return nodes
 }
 
-// Give the current Node tag to Params
+// If the constant node has no handler and only one constant child node, merge the child node into the current node.
 //
-// 将当前Node的tags给予Params
-func (r *radixNode) AddTagsToParams(p Params) {
-	for i := range r.tags {
-		p.AddParam(r.tags[i], r.vals[i])
+// 如果常量节点没有处理者并且只有一个常量子节点，将子节点合并到当前节点。
+func (r *radixNode) mergeNode() {
+	if r.kind&(radixNodeKindParam|radixNodeKindWildcard) != 0 || r.handlers != nil || len(r.Cchildren) != 1 || len(r.Pchildren) != 0 || r.Wchildren != nil {
+		return
 	}
+	path := r.path + r.Cchildren[0].path
+	*r = *r.Cchildren[0]
+	r.path = path
 }
 
-// Get the tree of the corresponding method.
+// Batch registers all routes in fn on a copy of the routing data, and replaces the routing data atomically once fn returns.
 //
-// Support eudore.RouterAllMethod these methods, weak support will return 405 processing tree.
+// Registrations from other goroutines during the batch are also added to the batch, if fn panics the batch is discarded.
 //
-// 获取对应方法的树。
+// Batch在路由数据的副本上注册fn中的全部路由，fn返回后使用一次原子操作替换路由数据。
 //
-// 支持eudore.RouterAllMethod这些方法,弱不支持会返回405处理树。
-func (r *RouterRadix) getTree(method string) *radixNode {
-	switch method {
-	case MethodGet:
-		return &r.get
-	case MethodPost:
-		return &r.post
-	case MethodDelete:
-		return &r.delete
-	case MethodPut:
-		return &r.put
-	case MethodHead:
-		return &r.head
-	case MethodOptions:
-		return &r.options
-	case MethodPatch:
-		return &r.patch
-	default:
-		return &r.node405
+// 批量期间其他goroutine的注册也会加入批量，如果fn发生panic，批量会被丢弃。
+func (r *RouterRadix) Batch(fn func(RouterMethod)) {
+	r.batchTrees(func() {
+		fn(r.RouterMethod)
+	})
+}
+
+// URL method builds the url of the route named name, args are the parameter names and values in pairs.
+//
+// The route name is set by the name tag, such as "/users/:id name=user.show".
+//
+// URL使用名称为name的路由创建url，args为成对的参数名称和值。
+//
+// 路由名称使用name标签设置，例如"/users/:id name=user.show"。
+func (r *RouterRadix) URL(name string, args ...string) (string, error) {
+	pattern, ok := r.trees.Load().(*routerTrees).names[name]
+	if !ok {
+		return "", routeNameError(name)
 	}
+	return newRouteURL(pattern, args, nil)
+}
+
+// Whether the node has constant child nodes inside the segment, such as '.' in "/files/:name.:ext".
+//
+// 节点是否有段内的常量子节点，例如"/files/:name.:ext"中的'.'。
+func (r *radixNode) hasInnerChildren() bool {
+	for _, i := range r.Cchildren {
+		if i.path[0] != '/' {
+			return true
+		}
+	}
+	return false
+}
+
+// Recursively combine the handler of the node and its child nodes with the middlewares matched by the route.
+//
+// 递归使用路由匹配的中间件组合节点和子节点的处理者。
+func (r *radixNode) recursiveCombine(method string, middtree *middTree, notfound, notacceptable Handler) {
+	if r.handlers != nil {
+		r.combine(method, middtree, notfound, notacceptable)
+	}
+	for _, i := range r.Cchildren {
+		i.recursiveCombine(method, middtree, notfound, notacceptable)
+	}
+	for _, i := range r.Pchildren {
+		i.recursiveCombine(method, middtree, notfound, notacceptable)
+	}
+	if r.Wchildren != nil {
+		r.Wchildren.recursiveCombine(method, middtree, notfound, notacceptable)
+	}
+}
+
+// Recursively append the route information of the node and its child nodes, params is the parameter names passed.
+//
+// 递归追加节点和子节点的路由信息，params为经过的参数名称。
+func (r *radixNode) recursiveRoutes(method string, params []string, routes []RouteInfo) []RouteInfo {
+	if r.kind&(radixNodeKindParam|radixNodeKindWildcard) != 0 {
+		params = append(params[:len(params):len(params)], r.name)
+	}
+	if r.handler != nil {
+		routes = append(routes, newRouteInfo(method, r.tags, r.vals, params, nil, r.isany, r.mnum))
+	}
+	routes = appendGuardRoutes(routes, r.guards, method, params, nil)
+	for _, i := range r.Cchildren {
+		routes = i.recursiveRoutes(method, params, routes)
+	}
+	for _, i := range r.Pchildren {
+		routes = i.recursiveRoutes(method, params, routes)
+	}
+	if r.Wchildren != nil {
+		routes = r.Wchildren.recursiveRoutes(method, params, routes)
+	}
+	return routes
+}
+
+// Get the route information of the node and its child nodes.
+//
+// 获取节点和子节点的路由信息。
+func (r *radixNode) getRoutes(method string, routes []RouteInfo) []RouteInfo {
+	return r.recursiveRoutes(method, nil, routes)
 }
 
 // 按照顺序匹配一个路径。
 //
 // 依次检查常量节点、参数节点、通配符节点，如果有一个匹配就直接返回。
-func (r *radixNode) recursiveLoopup(searchKey string, params Params) Handler {
+//
+// 如果fold为true，常量节点为小写，请求路径的常量部分忽略大小写匹配，参数值保持请求的大小写。
+func (r *radixNode) recursiveLoopup(searchKey string, params Params, fold bool) Handler {
 	// 如果路径为空，当前节点就是需要匹配的节点，直接返回。
 	if len(searchKey) == 0 && r.handlers != nil {
 		r.AddTagsToParams(params)
@@ -386,11 +761,16 @@ func (r *radixNode) recursiveLoopup(searchKey string, params Params) Handler {
 
 	if len(searchKey) > 0 {
 		// 遍历常量Node匹配，寻找具有相同前缀的那个节点
+		// 忽略大小写时常量为小写，使用小写的首字母比较
+		first := searchKey[0]
+		if fold {
+			first = toLowerASCII(first)
+		}
 		for _, edgeObj := range r.Cchildren {
-			if edgeObj.path[0] >= searchKey[0] {
-				if len(searchKey) >= len(edgeObj.path) && searchKey[:len(edgeObj.path)] == edgeObj.path {
+			if edgeObj.path[0] >= first {
+				if len(searchKey) >= len(edgeObj.path) && (searchKey[:len(edgeObj.path)] == edgeObj.path || (fold && equalFoldASCII(searchKey[:len(edgeObj.path)], edgeObj.path))) {
 					nextSearchKey := searchKey[len(edgeObj.path):]
-					if n := edgeObj.recursiveLoopup(nextSearchKey, params); n != nil {
+					if n := edgeObj.recursiveLoopup(nextSearchKey, params, fold); n != nil {
 						return n
 					}
 				}
@@ -408,7 +788,16 @@ func (r *radixNode) recursiveLoopup(searchKey string, params Params) Handler {
 			// Whether the variable Node matches in sequence is satisfied
 			// 遍历参数节点是否后续匹配
 			for _, edgeObj := range r.Pchildren {
-				if n := edgeObj.recursiveLoopup(nextSearchKey, params); n != nil {
+				// 参数后有段内常量，从最长的值开始依次尝试在段内结束参数
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if n := edgeObj.recursiveLoopup(searchKey[i:], params, fold); n != nil {
+							params.AddParam(edgeObj.name, searchKey[:i])
+							return n
+						}
+					}
+				}
+				if n := edgeObj.recursiveLoopup(nextSearchKey, params, fold); n != nil {
 					params.AddParam(edgeObj.name, searchKey[:pos])
 					return n
 				}
@@ -429,6 +818,56 @@ func (r *radixNode) recursiveLoopup(searchKey string, params Params) Handler {
 	return nil
 }
 
+// Match a path with the constant nodes case-insensitively in the same order as recursiveLoopup,
+// the matched constants are written to buf with the registered case, the param and wildcard values are kept as sent.
+//
+// 按照和recursiveLoopup相同的顺序匹配一个路径，常量节点忽略大小写匹配，
+// 匹配的常量使用注册的大小写写入buf，参数和通配符的值保持请求的大小写。
+func (r *radixNode) recursiveCasePath(searchKey string, buf []byte) bool {
+	if len(searchKey) == 0 && r.handlers != nil {
+		return true
+	}
+
+	if len(searchKey) > 0 {
+		// 常量node按照首字母排序，大写字母在小写字母之前
+		pos := len(buf) - len(searchKey)
+		lower := toLowerASCII(searchKey[0])
+		for _, edgeObj := range r.Cchildren {
+			if edgeObj.path[0] > lower {
+				break
+			}
+			if len(searchKey) >= len(edgeObj.path) && equalFoldASCII(searchKey[:len(edgeObj.path)], edgeObj.path) {
+				copy(buf[pos:], edgeObj.path)
+				if edgeObj.recursiveCasePath(searchKey[len(edgeObj.path):], buf) {
+					return true
+				}
+				copy(buf[pos:], searchKey[:len(edgeObj.path)])
+			}
+		}
+
+		if len(r.Pchildren) > 0 {
+			pos := strings.IndexByte(searchKey, '/')
+			if pos == -1 {
+				pos = len(searchKey)
+			}
+			for _, edgeObj := range r.Pchildren {
+				if edgeObj.hasInnerChildren() {
+					for i := pos - 1; i > 0; i-- {
+						if edgeObj.recursiveCasePath(searchKey[i:], buf) {
+							return true
+						}
+					}
+				}
+				if edgeObj.recursiveCasePath(searchKey[pos:], buf) {
+					return true
+				}
+			}
+		}
+	}
+
+	return r.Wchildren != nil
+}
+
 /*
 The string is cut according to the Node type.
 将字符串按Node类型切割
@@ -447,6 +886,14 @@ String path cutting example:
 /api/:name|^\\d+$/info	[/api/ :name|^\d+$ /info]
 /api/*|^0/api\\S+$		[/api/ *|^0 /api\S+$]
 /api/*|^\\$\\d+$		[/api/ *|^\$\d+$]
+/users/:user-id		[/users/ :user-id]
+/files/:name.:ext	[/files/ :name . :ext]
+/files/:name|alpha.:ext	[/files/ :name|alpha . :ext]
+/v1/items:batchGet	[/v1/items:batchGet]
+/v{:version}/items	[/v {:version} /items]
+/@{:user}		[/@ {:user}]
+/list/:page?		[/list/ :page?]
+/list/:page=1|isnum	[/list/ :page=1|isnum]
 */
 func getSplitPath(key string) []string {
 	if len(key) < 2 {
@@ -454,39 +901,121 @@ func getSplitPath(key string) []string {
 	}
 	var strs []string
 	var length int = -1
-	var ismatch bool = false
-	var isconst bool = false
+	// 当前片段类型，'/'常量、':'参数名称、'*'通配符名称、'='可选参数标记和默认值、'|'校验函数、'^'正则、'{'括号内的参数
+	var kind byte
+	// 当前路径段的参数在段内结束，段内之后的':'开始新的参数
+	var chain bool
 	for i := range key {
-		if ismatch {
+		switch kind {
+		case '=':
+			if key[i] != '/' {
+				if key[i] == '|' {
+					kind = '|'
+				}
+				strs[length] = strs[length] + key[i:i+1]
+				continue
+			}
+		case '^':
 			strs[length] = strs[length] + key[i:i+1]
 			if key[i] == '$' && key[i-1] != '\\' && (i == len(key)-1 || key[i+1] == '/') {
-				ismatch = false
+				kind = '|'
 			}
 			continue
-		}
-		// fmt.Println(last, key[i:i+1])
-		switch key[i] {
-		case '/':
-			if !isconst {
-				length++
-				strs = append(strs, "")
-				isconst = true
-
+		case '|':
+			// 参数的校验函数在段内之后参数前的常量处结束
+			if key[i] != '/' && (strs[length][0] != ':' || !isCheckEnd(key[i:])) {
+				if key[i] == '^' {
+					kind = '^'
+				}
+				strs[length] = strs[length] + key[i:i+1]
+				continue
+			}
+			chain = key[i] != '/'
+		case '{':
+			strs[length] = strs[length] + key[i:i+1]
+			if key[i] == '}' {
+				kind = '}'
 			}
+			continue
 		case ':', '*':
-			isconst = false
-			if key[i-1] == '/' {
-				length++
-				strs = append(strs, "")
+			if key[i] == '|' {
+				kind = '|'
+				strs[length] = strs[length] + key[i:i+1]
+				continue
 			}
-		case '^':
-			ismatch = true
+			// 参数名称后的'?'和'='开始可选标记和默认值
+			if kind == ':' && (key[i] == '?' || key[i] == '=') {
+				kind = '='
+				strs[length] = strs[length] + key[i:i+1]
+				continue
+			}
+			// 名称遇到'/'结束，段内之后还有':'时参数名称在非名称字符处结束
+			if key[i] != '/' && (kind == '*' || isParamNameChar(key[i]) || !hasSegmentParam(key[i:])) {
+				strs[length] = strs[length] + key[i:i+1]
+				continue
+			}
+			chain = key[i] != '/'
+		}
+		// 常量字符，路径段开始的':'和'*'、参数后段内的':'和'{:'开始新的片段
+		switch {
+		case key[i] == '{' && i+1 < len(key) && key[i+1] == ':':
+			kind = '{'
+		case (key[i] == ':' || key[i] == '*') && i > 0 && key[i-1] == '/':
+			kind = key[i]
+		case key[i] == ':' && chain:
+			kind = ':'
+		case kind != '/':
+			kind = '/'
+		default:
+			if key[i] == '/' {
+				chain = false
+			}
+			strs[length] = strs[length] + key[i:i+1]
+			continue
 		}
-		strs[length] = strs[length] + key[i:i+1]
+		if key[i] == '/' {
+			chain = false
+		}
+		length++
+		strs = append(strs, key[i:i+1])
 	}
 	return strs
 }
 
+// Whether there is a param after the current param in the segment, then the param name ends at the char that can not be used in the name.
+//
+// 路径段内当前参数之后是否还有参数，有时参数名称在不能用于名称的字符处结束。
+func hasSegmentParam(key string) bool {
+	for i := 0; i < len(key) && key[i] != '/'; i++ {
+		if key[i] == ':' {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the check function of the param ends at the current char, the constant chars before a ':' param in the segment end the check function.
+//
+// 参数的校验函数是否在当前字符结束，路径段内参数的':'之前的常量字符结束校验函数，例如":name|alpha.:ext"中的'.'。
+func isCheckEnd(key string) bool {
+	for i := 0; i < len(key); i++ {
+		switch {
+		case key[i] == ':':
+			return i > 0 && i+1 < len(key) && isParamNameChar(key[i+1])
+		case key[i] == '/' || key[i] == '|' || isParamNameChar(key[i]):
+			return false
+		}
+	}
+	return false
+}
+
+// Whether the char can be used in the param name, if there is another param in the segment, the param name ends at other chars.
+//
+// 字符是否可以用于参数名称，如果路径段内还有参数，参数名称在其他字符处结束。
+func isParamNameChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
 // Get the largest common prefix of the two strings,
 // return the largest common prefix and have the largest common prefix.
 //
@@ -510,22 +1039,6 @@ func getSubsetPrefix(str1, str2 string) (string, bool) {
 	return str1, findSubset
 }
 
-// Check if the string str2 is the prefix of str1.
-//
-// 检测字符串str2是否为str1的前缀。
-func contrainPrefix(str1, str2 string) bool {
-	if len(str1) < len(str2) {
-		return false
-	}
-	for i := 0; i < len(str2); i++ {
-		if str1[i] != str2[i] {
-			return false
-		}
-	}
-
-	return true
-}
-
 // Use sep to split str into two strings.
 func split2byte(str string, b byte) (string, string) {
 	pos := strings.IndexByte(str, b)
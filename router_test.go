@@ -0,0 +1,645 @@
+package erouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// 测试用的处理者，返回路由和参数
+func newTestHandler(names ...string) Handler {
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		w.Write([]byte(p.GetParam(ParamRoute)))
+		for _, name := range names {
+			w.Write([]byte(" " + name + "=" + p.GetParam(name)))
+		}
+	}
+}
+
+// 测试请求，返回状态码和body
+func doTestRequest(r http.Handler, method, path string) (int, string) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w.Code, w.Body.String()
+}
+
+func TestRouterParamName(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/users/:user-id", newTestHandler("user-id"))
+		r.Get("/f/:file.json", newTestHandler("file.json"))
+		r.Get("/v1/items:batchGet", newTestHandler())
+		r.Get("/v1/:name", newTestHandler("name"))
+		r.Get("/files/:name.:ext", newTestHandler("name", "ext"))
+		r.Get("/v{:version}/items", newTestHandler("version"))
+		r.Get("/@{:user}", newTestHandler("user"))
+		for path, body := range map[string]string{
+			"/users/42":          "/users/:user-id user-id=42",
+			"/f/a.txt":           "/f/:file.json file.json=a.txt",
+			"/v1/items:batchGet": "/v1/items:batchGet",
+			"/v1/items":          "/v1/:name name=items",
+			"/files/a.tar.gz":    "/files/:name.:ext name=a.tar ext=gz",
+			"/v2/items":          "/v{:version}/items version=2",
+			"/@eudore":           "/@{:user} user=eudore",
+		} {
+			if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+				t.Errorf("%T %s: %d %q, want %q", r, path, code, got, body)
+			}
+		}
+	}
+}
+
+func TestRouterRedirectHost(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.RedirectTrailingSlash, radix.RedirectFixedPath = true, true
+	full.RedirectTrailingSlash, full.RedirectFixedPath = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/:x/", newTestHandler("x"))
+		r.Get("/a b/", newTestHandler())
+		for path, location := range map[string]string{
+			"/%5Cevil.com":    "",
+			"/%2F%2Fevil.com": "/evil.com/",
+			"//evil.com":      "/evil.com/",
+			"/a%20b":          "/a%20b/",
+			"/x/../a%20b":     "/a%20b/",
+		} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if got := w.Header().Get("Location"); got != location {
+				t.Errorf("%T %s: %d Location %q, want %q", r, path, w.Code, got, location)
+			}
+		}
+	}
+}
+
+func TestRouterStrictAtomic(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.Strict, full.Strict = true, true
+	for _, r := range []Router{radix, full} {
+		if err := r.RegisterHandler("PUT", "/z", newTestHandler()); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.RegisterHandler("ANY", "/z", newTestHandler()); err == nil {
+			t.Errorf("%T Any /z after PUT /z: no error", r)
+		}
+		if err := r.RegisterHandler("GET", "/list/:p", newTestHandler("p")); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.RegisterHandler("GET", "/list/:page?", newTestHandler("page")); err == nil {
+			t.Errorf("%T /list/:page? after /list/:p: no error", r)
+		}
+		for _, c := range []struct {
+			method, path string
+			code         int
+		}{
+			{"GET", "/z", 405},
+			{"POST", "/z", 405},
+			{"PUT", "/z", 200},
+			{"GET", "/list", 404},
+			{"GET", "/list/2", 200},
+		} {
+			if code, _ := doTestRequest(r, c.method, c.path); code != c.code {
+				t.Errorf("%T %s %s: %d, want %d", r, c.method, c.path, code, c.code)
+			}
+		}
+	}
+}
+
+func TestRouterRegisterAtomic(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.AnyMethods = []string{MethodGet, MethodPost, "BAD METHOD"}
+	full.AnyMethods = []string{MethodGet, MethodPost, "BAD METHOD"}
+	for _, r := range []Router{radix, full} {
+		r.Get("/", newTestHandler())
+		r.Post("/", newTestHandler())
+		if err := r.RegisterHandler("ANY", "/m", newTestHandler()); err == nil {
+			t.Errorf("%T Any with an invalid method: no error", r)
+		}
+		for _, method := range []string{"GET", "POST"} {
+			if code, _ := doTestRequest(r, method, "/m"); code != 404 {
+				t.Errorf("%T %s /m: %d, want 404", r, method, code)
+			}
+		}
+	}
+	if err := full.RegisterHandler("GET", "/c/:id|nocheck", newTestHandler()); err == nil {
+		t.Errorf("undefined check function: no error")
+	}
+	if code, _ := doTestRequest(full, "GET", "/c/1"); code != 404 {
+		t.Errorf("GET /c/1: %d, want 404", code)
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/users", newTestHandler())
+		for _, c := range []struct {
+			method, path string
+			code         int
+			allow        string
+		}{
+			{"PROPFIND", "/nothing", 404, ""},
+			{"PROPFIND", "/users", 405, "GET"},
+			{"POST", "/users", 405, "GET"},
+			{"POST", "/nothing", 404, ""},
+		} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+			if w.Code != c.code || w.Header().Get("Allow") != c.allow {
+				t.Errorf("%T %s %s: %d Allow %q, want %d %q", r, c.method, c.path, w.Code, w.Header().Get("Allow"), c.code, c.allow)
+			}
+		}
+	}
+}
+
+func TestRouterSplitArgs(t *testing.T) {
+	for key, args := range map[string][]string{
+		`/a desc="list all users" k=v`: {"/a", "desc=list all users", "k=v"},
+		`/a desc=a\ b`:                 {"/a", "desc=a b"},
+		`/q/:s|^"[a-z]+"$ k=v`:         {`/q/:s|^"[a-z]+"$`, "k=v"},
+		`/q/:s|^\"a b\"$/x`:            {`/q/:s|^\"a b\"$/x`},
+		`/q/:s|^a b`:                   {"/q/:s|^a", "b"},
+		`/say"hi" k="a b"`:             {`/say"hi"`, "k=a b"},
+		`/a\b\ c`:                      {`/a\b\`, "c"},
+	} {
+		if got := splitRouteArgs(key); !reflect.DeepEqual(got, args) {
+			t.Errorf("%s: %q, want %q", key, got, args)
+		}
+	}
+
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get(`/say"hi"`, newTestHandler())
+		if code, body := doTestRequest(r, "GET", "/say%22hi%22"); code != 200 || body != `/say"hi"` {
+			t.Errorf("%T GET /say\"hi\": %d %q", r, code, body)
+		}
+	}
+
+	r := NewRouterFull()
+	r.Get(`/q/:s|^"[a-z]+"$`, newTestHandler("s"))
+	if code, body := doTestRequest(r, "GET", "/q/%22abc%22"); code != 200 || body != `/q/:s|^"[a-z]+"$ s="abc"` {
+		t.Errorf("GET /q/\"abc\": %d %q", code, body)
+	}
+	if code, _ := doTestRequest(r, "GET", "/q/abc"); code != 404 {
+		t.Errorf("GET /q/abc: %d, want 404", code)
+	}
+}
+
+func TestRouterNotFoundAllocs(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/users/:id", newTestHandler())
+		r.Get("/static/*", newTestHandler())
+		match := r.(interface {
+			Match(string, string, Params) Handler
+		}).Match
+		p := &ParamsArray{}
+		allocs := testing.AllocsPerRun(100, func() {
+			p.Reset()
+			match("GET", "/Users/1/", p)
+		})
+		if allocs != 0 {
+			t.Errorf("%T allocs of a 404 match: %v, want 0", r, allocs)
+		}
+	}
+}
+
+func TestRouterAutoOptionsMiddleware(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.AutoOptions, full.AutoOptions = true, true
+	for _, r := range []Router{radix, full} {
+		r.AddMiddleware(MethodAny, "/ mwname=cors", func(h Handler) Handler {
+			return func(w http.ResponseWriter, req *http.Request, p Params) {
+				w.Header().Set("X-Mw", "cors")
+				h(w, req, p)
+			}
+		})
+		r.Get("/:name", newTestHandler("name"))
+		for _, path := range []string{"/a", "/a%20skip=cors", "/:name"} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("OPTIONS", path, nil))
+			if w.Code != 204 || w.Header().Get("Allow") != "GET, OPTIONS" || w.Header().Get("X-Mw") != "cors" {
+				t.Errorf("%T OPTIONS %s: %d Allow %q X-Mw %q", r, path, w.Code, w.Header().Get("Allow"), w.Header().Get("X-Mw"))
+			}
+		}
+	}
+}
+
+func TestRouterMiddlewareName(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.Strict, full.Strict = true, true
+	for _, r := range []Router{radix, full} {
+		admin := r.Group("/admin mwname=auth")
+		admin.AddMiddleware(MethodAny, "", func(h Handler) Handler {
+			return func(w http.ResponseWriter, req *http.Request, p Params) {
+				w.Write([]byte("auth "))
+				h(w, req, p)
+			}
+		})
+		admin.Get("/a name=a", newTestHandler())
+		admin.Post("/a name=a", newTestHandler())
+		admin.Get("/b", newTestHandler())
+		admin.Get("/c skip=auth", newTestHandler())
+		if err := r.Err(); err != nil {
+			t.Errorf("%T Err: %v", r, err)
+		}
+		if url, err := r.URL("a"); url != "/admin/a" || err != nil {
+			t.Errorf("%T URL a: %q %v", r, url, err)
+		}
+		if _, err := r.URL("auth"); err == nil {
+			t.Errorf("%T URL auth: the middleware name is a route name", r)
+		}
+		for path, body := range map[string]string{
+			"/admin/a": "auth /admin/a",
+			"/admin/b": "auth /admin/b",
+			"/admin/c": "/admin/c",
+		} {
+			if _, got := doTestRequest(r, "GET", path); got != body {
+				t.Errorf("%T GET %s: %q, want %q", r, path, got, body)
+			}
+		}
+		r.RemoveMiddleware(MethodAny, "/admin", "auth")
+		if _, got := doTestRequest(r, "GET", "/admin/b"); got != "/admin/b" {
+			t.Errorf("%T GET /admin/b after RemoveMiddleware: %q", r, got)
+		}
+
+		r.Get("/x name=a", newTestHandler())
+		if code, _ := doTestRequest(r, "GET", "/x"); code != 404 || r.Err() == nil {
+			t.Errorf("%T strict mode registers the duplicate route name a: %d %v", r, code, r.Err())
+		}
+	}
+}
+
+func TestRouterRemoveHandler(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	for _, r := range []Router{radix, full} {
+		r.Get("/users/ab", newTestHandler())
+		r.Get("/users/ac", newTestHandler())
+		r.Get("/users/:id/x", newTestHandler("id"))
+		r.RemoveHandler("GET", "/users/ab")
+		r.RemoveHandler("GET", "/users/:id/x")
+		for path, code := range map[string]int{"/users/ab": 404, "/users/ac": 200, "/users/1/x": 404} {
+			if got, _ := doTestRequest(r, "GET", path); got != code {
+				t.Errorf("%T GET %s: %d, want %d", r, path, got, code)
+			}
+		}
+	}
+	// 删除后裁剪空节点并合并为一个常量节点
+	radixTree := radix.trees.Load().(*routerTrees).getTree("GET").(*radixNode)
+	if len(radixTree.Cchildren) != 1 || radixTree.Cchildren[0].path != "/users/ac" || len(radixTree.Cchildren[0].Cchildren) != 0 || len(radixTree.Cchildren[0].Pchildren) != 0 {
+		t.Errorf("RouterRadix tree is not merged: %#v", radixTree.Cchildren)
+	}
+	fullTree := full.trees.Load().(*routerTrees).getTree("GET").(*fullNode)
+	if len(fullTree.Cchildren) != 1 || fullTree.Cchildren[0].path != "/users/ac" || len(fullTree.Cchildren[0].Cchildren) != 0 || fullTree.Cchildren[0].pnum != 0 {
+		t.Errorf("RouterFull tree is not merged: %#v", fullTree.Cchildren)
+	}
+}
+
+func TestRouterFullRemoveParam(t *testing.T) {
+	r := NewRouterFull().(*RouterFull)
+	r.Get("/f/:id|isnum", newTestHandler("id"))
+	r.Get("/f/:name", newTestHandler("name"))
+	r.Get("/f/*path|^a", newTestHandler("path"))
+	r.Get("/f/*", newTestHandler("*"))
+	node := func() *fullNode {
+		tree := r.trees.Load().(*routerTrees).getTree("GET").(*fullNode)
+		if len(tree.Cchildren) == 0 {
+			return nil
+		}
+		return tree.Cchildren[0]
+	}
+	for _, c := range []struct {
+		remove string
+		pnum   uint8
+		bodies map[string]string
+	}{
+		{"/f/:id|isnum", 1, map[string]string{"/f/1": "/f/:name name=1", "/f/a/b": "/f/*path|^a path=a/b"}},
+		{"/f/:name", 0, map[string]string{"/f/1": "/f/* *=1", "/f/a": "/f/*path|^a path=a"}},
+		{"/f/*path|^a", 0, map[string]string{"/f/a": "/f/* *=a"}},
+	} {
+		r.RemoveHandler("GET", c.remove)
+		if n := node(); n == nil || n.pnum != c.pnum {
+			t.Errorf("remove %s: pnum of /f/ is not %d: %#v", c.remove, c.pnum, n)
+		}
+		for path, body := range c.bodies {
+			if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+				t.Errorf("remove %s: GET %s: %d %q, want %q", c.remove, path, code, got, body)
+			}
+		}
+	}
+	r.RemoveHandler("GET", "/f/*")
+	if n := node(); n != nil {
+		t.Errorf("empty node /f/ is not pruned: %#v", n)
+	}
+	if code, _ := doTestRequest(r, "GET", "/f/a"); code != 404 {
+		t.Errorf("GET /f/a: %d, want 404", code)
+	}
+}
+
+func TestRouterReplaceHandlerRace(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/r/:id", newTestHandler())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 200; i++ {
+				r.ReplaceHandler("GET", "/r/:id", newTestHandler("id"))
+				r.ReplaceHandler("GET", "/r/:id", newTestHandler())
+			}
+		}()
+		for i := 0; i < 200; i++ {
+			if code, body := doTestRequest(r, "GET", "/r/1"); code != 200 || (body != "/r/:id" && body != "/r/:id id=1") {
+				t.Fatalf("%T GET /r/1 during ReplaceHandler: %d %q", r, code, body)
+			}
+		}
+		<-done
+	}
+}
+
+func TestRouterCopyOnWrite(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.CopyOnWrite, full.CopyOnWrite = true, true
+	for _, r := range []struct {
+		Router
+		store *routerStore
+	}{{radix, &radix.routerStore}, {full, &full.routerStore}} {
+		r.Get("/old", newTestHandler())
+		old := r.store.trees.Load().(*routerTrees)
+		r.Get("/new", newTestHandler())
+		p := &ParamsArray{}
+		if old.getTree("GET").recursiveLoopup("/new", p, false) != nil {
+			t.Errorf("%T the published routing data is modified", r.Router)
+		}
+		if code, _ := doTestRequest(r, "GET", "/new"); code != 200 {
+			t.Errorf("%T GET /new: %d, want 200", r.Router, code)
+		}
+	}
+}
+
+func TestRouterBatch(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	for _, r := range []struct {
+		Router
+		store *routerStore
+		batch func(func(RouterMethod))
+	}{{radix, &radix.routerStore, radix.Batch}, {full, &full.routerStore, full.Batch}} {
+		// 读取者在一份路由数据中只能看到全部或没有批量注册的路由
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p := &ParamsArray{}
+			for i := 0; i < 1000; i++ {
+				tree := r.store.trees.Load().(*routerTrees).getTree("GET")
+				p.Reset()
+				first := tree.recursiveLoopup("/b/0", p, false) != nil
+				p.Reset()
+				if last := tree.recursiveLoopup("/b/99", p, false) != nil; first != last {
+					t.Errorf("%T half a batch is published", r.Router)
+					return
+				}
+			}
+		}()
+		r.batch(func(m RouterMethod) {
+			for i := 0; i < 100; i++ {
+				m.Get("/b/"+strconv.Itoa(i), newTestHandler())
+			}
+		})
+		<-done
+
+		// fn发生panic时丢弃批量，注册错误保留
+		func() {
+			defer func() {
+				recover()
+			}()
+			r.batch(func(m RouterMethod) {
+				m.Get("/p", newTestHandler())
+				m.AddHandler("BAD METHOD", "/p", newTestHandler())
+				panic("batch")
+			})
+		}()
+		if code, _ := doTestRequest(r, "GET", "/p"); code != 404 {
+			t.Errorf("%T GET /p after a panic batch: %d, want 404", r.Router, code)
+		}
+		if r.Err() == nil {
+			t.Errorf("%T the error in a panic batch is discarded", r.Router)
+		}
+	}
+}
+
+func TestRouterRegisterRace(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.CopyOnWrite, full.CopyOnWrite = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/a", newTestHandler())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				r.Get("/c/"+strconv.Itoa(i), newTestHandler())
+				r.AddMiddleware(MethodAny, "/c/"+strconv.Itoa(i), func(h Handler) Handler {
+					return h
+				})
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			if code, _ := doTestRequest(r, "GET", "/a"); code != 200 {
+				t.Fatalf("%T GET /a during registration: %d", r, code)
+			}
+			doTestRequest(r, "GET", "/c/"+strconv.Itoa(i))
+		}
+		<-done
+		if code, _ := doTestRequest(r, "GET", "/c/99"); code != 200 {
+			t.Errorf("%T GET /c/99: %d, want 200", r, code)
+		}
+	}
+}
+
+func TestRouterMatchAllocs(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/users/:id", newTestHandler())
+		match := r.(interface {
+			Match(string, string, Params) Handler
+		}).Match
+		p := &ParamsArray{}
+		allocs := testing.AllocsPerRun(100, func() {
+			p.Reset()
+			match("GET", "/users/1", p)
+		})
+		if allocs != 0 {
+			t.Errorf("%T allocs of a matched route: %v, want 0", r, allocs)
+		}
+	}
+}
+
+func TestRouterOptionalParam(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/list/:page=1|isnum", newTestHandler("page"))
+		r.Get("/archive/:year?/:month?", newTestHandler("year", "month"))
+		for path, body := range map[string]string{
+			"/list":            "/list/:page=1|isnum page=1",
+			"/list/5":          "/list/:page=1|isnum page=5",
+			"/archive":         "/archive/:year?/:month? year= month=",
+			"/archive/2020":    "/archive/:year?/:month? year=2020 month=",
+			"/archive/2020/05": "/archive/:year?/:month? year=2020 month=05",
+		} {
+			if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+				t.Errorf("%T %s: %d %q, want %q", r, path, code, got, body)
+			}
+		}
+		if err := r.Err(); err != nil {
+			t.Errorf("%T err: %v", r, err)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.Get("/users/:id/files/* name=file", newTestHandler())
+		r.Get("/list/:page=1 name=list", newTestHandler())
+		r.Get("/static/*path name=static", newTestHandler())
+		for want, args := range map[string][]string{
+			"/users/42/files/a/b.txt":    {"file", "id", "42", "*", "a/b.txt"},
+			"/users/a%20b/files/c%20d/e": {"file", "id", "a b", "*", "c d/e"},
+			"/users/a%2Fb/files/c":       {"file", "id", "a/b", "*", "c"},
+			"/list/5":                    {"list", "page", "5"},
+			"/list":                      {"list"},
+			"/static/css/app.css":        {"static", "path", "css/app.css"},
+		} {
+			if got, err := r.URL(args[0], args[1:]...); err != nil || got != want {
+				t.Errorf("%T URL%q: %q %v, want %q", r, args, got, err, want)
+			}
+		}
+		for _, args := range [][]string{
+			{"notexist"},
+			{"file", "id", "42"},
+			{"file", "id"},
+		} {
+			if got, err := r.URL(args[0], args[1:]...); err == nil {
+				t.Errorf("%T URL%q: %q, want an error", r, args, got)
+			}
+		}
+	}
+
+	r := NewRouterFull()
+	r.Get("/users/:id|isnum|min:1 name=user", newTestHandler())
+	r.Get("/files/*path|suffix:.txt name=files", newTestHandler())
+	if got, err := r.URL("user", "id", "42"); err != nil || got != "/users/42" {
+		t.Errorf("URL user 42: %q %v", got, err)
+	}
+	for _, args := range [][]string{
+		{"user", "id", "x"},
+		{"user", "id", "0"},
+		{"files", "path", "a/b.png"},
+	} {
+		if got, err := r.URL(args[0], args[1:]...); err == nil {
+			t.Errorf("URL%q: %q, want a check error", args, got)
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	for _, r := range []Router{NewRouterRadix(), NewRouterFull()} {
+		r.AddMiddleware(MethodAny, "/", func(h Handler) Handler { return h })
+		r.AddMiddleware(MethodAny, "/api", func(h Handler) Handler { return h })
+		r.Get("/api/users/:id|isnum name=user", newTestHandler())
+		r.Any("/any", newTestHandler())
+		r.Get("/list/:page=1", newTestHandler())
+		routes := make(map[string][]RouteInfo)
+		for _, route := range r.Routes() {
+			routes[route.Method+" "+route.Path] = append(routes[route.Method+" "+route.Path], route)
+		}
+
+		want := RouteInfo{Method: "GET", Path: "/api/users/:id|isnum", Tags: map[string]string{"name": "user"}, Params: []string{"id"}, Middlewares: 2}
+		if _, ok := r.(*RouterFull); ok {
+			want.Checks = map[string]string{"id": "isnum"}
+		}
+		if got := routes["GET /api/users/:id|isnum"]; len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+			t.Errorf("%T routes %#v, want %#v", r, got, want)
+		}
+		for _, method := range RouterAllMethod {
+			got := routes[method+" /any"]
+			if len(got) != 1 || !got[0].Any || got[0].Middlewares != 1 {
+				t.Errorf("%T routes %s /any: %#v", r, method, got)
+			}
+		}
+		// 可选参数展开为两条信息
+		got := routes["GET /list/:page=1"]
+		if len(got) != 2 {
+			t.Fatalf("%T routes /list/:page=1: %#v", r, got)
+		}
+		if got[0].Tags["page"] == "1" {
+			got[0], got[1] = got[1], got[0]
+		}
+		if !reflect.DeepEqual(got[0].Params, []string{"page"}) || len(got[1].Params) != 0 || got[1].Tags["page"] != "1" {
+			t.Errorf("%T routes /list/:page=1: %#v", r, got)
+		}
+	}
+}
+
+func TestRouterCaseInsensitive(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.CaseInsensitive, radix.Strict = true, true
+	full.CaseInsensitive, full.Strict = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/api/users/:Name", newTestHandler("Name"))
+		r.Get("/Static/*", newTestHandler("*"))
+		for path, body := range map[string]string{
+			"/API/Users/AbC":    "/api/users/:Name Name=AbC",
+			"/api/users/abc":    "/api/users/:Name Name=abc",
+			"/static/Img/A.PNG": "/Static/* *=Img/A.PNG",
+		} {
+			if code, got := doTestRequest(r, "GET", path); code != 200 || got != body {
+				t.Errorf("%T %s: %d %q, want %q", r, path, code, got, body)
+			}
+		}
+		if r.Err() != nil {
+			t.Fatalf("%T err: %v", r, r.Err())
+		}
+		r.Get("/API/Users/:Name", newTestHandler())
+		if r.Err() == nil {
+			t.Errorf("%T strict mode: case-only duplicate is not reported", r)
+		}
+	}
+
+	radix, full = NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.RedirectFixedCase, full.RedirectFixedCase = true, true
+	for _, r := range []Router{radix, full} {
+		r.Get("/API/Users/:name", newTestHandler("name"))
+		r.Post("/API/Users/:name", newTestHandler("name"))
+		for method, code := range map[string]int{"GET": 301, "POST": 308} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(method, "/api/users/AbC?x=1", nil))
+			if w.Code != code || w.Header().Get("Location") != "/API/Users/AbC?x=1" {
+				t.Errorf("%T %s /api/users/AbC: %d %q, want %d", r, method, w.Code, w.Header().Get("Location"), code)
+			}
+		}
+	}
+}
+
+func TestRouterExtensionMethod(t *testing.T) {
+	radix, full := NewRouterRadix().(*RouterRadix), NewRouterFull().(*RouterFull)
+	radix.AnyMethods = []string{"GET", "PURGE"}
+	full.AnyMethods = []string{"GET", "PURGE"}
+	for _, r := range []Router{radix, full} {
+		r.AddHandler("PURGE", "/cache/:key", newTestHandler("key"))
+		r.AddHandler("MKCOL", "/dav/*", newTestHandler("*"))
+		r.Any("/any", newTestHandler())
+		if err := r.Err(); err != nil {
+			t.Fatalf("%T err: %v", r, err)
+		}
+		for _, c := range []struct{ method, path, body string }{
+			{"PURGE", "/cache/a", "/cache/:key key=a"},
+			{"MKCOL", "/dav/a/b", "/dav/* *=a/b"},
+			{"GET", "/any", "/any"},
+			{"PURGE", "/any", "/any"},
+		} {
+			if code, got := doTestRequest(r, c.method, c.path); code != 200 || got != c.body {
+				t.Errorf("%T %s %s: %d %q, want %q", r, c.method, c.path, code, got, c.body)
+			}
+		}
+		if code, _ := doTestRequest(r, "POST", "/any"); code != 405 {
+			t.Errorf("%T POST /any: %d, want 405", r, code)
+		}
+	}
+	if stringSliceContains(RouterAllMethod, "PURGE") {
+		t.Errorf("RouterAllMethod is changed: %v", RouterAllMethod)
+	}
+}